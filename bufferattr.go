@@ -0,0 +1,162 @@
+package pulse
+
+import (
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// PlaybackBufferAttr describes the server-side buffer of a playback stream.
+// All sizes are in bytes. When changing the attributes, proto.Undefined lets the server choose a value.
+type PlaybackBufferAttr struct {
+	MaxLength      uint32 // maximum size of the buffer
+	TargetLength   uint32 // the server tries to keep the buffer filled to this size
+	Prebuffer      uint32 // playback starts when the buffer contains this much data
+	MinimumRequest uint32 // the server does not request less data than this
+}
+
+// RecordBufferAttr describes the server-side buffer of a record stream.
+// All sizes are in bytes. When changing the attributes, proto.Undefined lets the server choose a value.
+type RecordBufferAttr struct {
+	MaxLength    uint32 // maximum size of the buffer
+	FragmentSize uint32 // the server sends data in fragments of this size
+}
+
+// BufferAttr returns the current buffer attributes of the stream.
+func (p *PlaybackStream) BufferAttr() PlaybackBufferAttr {
+	p.bufferLock.Lock()
+	defer p.bufferLock.Unlock()
+	return PlaybackBufferAttr{
+		MaxLength:      p.createReply.BufferMaxLength,
+		TargetLength:   p.createReply.BufferTargetLength,
+		Prebuffer:      p.createReply.BufferPrebufferLength,
+		MinimumRequest: p.createReply.BufferMinimumRequest,
+	}
+}
+
+// SetBufferAttr changes the buffer attributes of a stream that is already running.
+// The server may not be able to use the requested values exactly, the values actually used are returned.
+func (p *PlaybackStream) SetBufferAttr(attr PlaybackBufferAttr) (PlaybackBufferAttr, error) {
+	return p.setBufferAttr(attr, false)
+}
+
+// SetLatency changes the latency of a stream that is already running, like the PlaybackLatency option.
+// The resulting buffer attributes are returned.
+func (p *PlaybackStream) SetLatency(latency time.Duration) (PlaybackBufferAttr, error) {
+	target := p.durationToBytes(latency)
+	return p.setBufferAttr(PlaybackBufferAttr{
+		MaxLength:      2 * target,
+		TargetLength:   target,
+		Prebuffer:      proto.Undefined,
+		MinimumRequest: proto.Undefined,
+	}, true)
+}
+
+func (p *PlaybackStream) setBufferAttr(attr PlaybackBufferAttr, adjustLatency bool) (PlaybackBufferAttr, error) {
+	var rpl proto.SetPlaybackStreamBufferAttrReply
+	err := p.c.request(&proto.SetPlaybackStreamBufferAttr{
+		StreamIndex:           p.index,
+		BufferMaxLength:       attr.MaxLength,
+		BufferTargetLength:    attr.TargetLength,
+		BufferPrebufferLength: attr.Prebuffer,
+		BufferMinimumRequest:  attr.MinimumRequest,
+		AdjustLatency:         adjustLatency,
+	}, &rpl)
+	if err != nil {
+		return PlaybackBufferAttr{}, err
+	}
+	attr = PlaybackBufferAttr{
+		MaxLength:      rpl.BufferMaxLength,
+		TargetLength:   rpl.BufferTargetLength,
+		Prebuffer:      rpl.BufferPrebufferLength,
+		MinimumRequest: rpl.BufferMinimumRequest,
+	}
+	p.bufferAttrChanged(attr, rpl.SinkLatency)
+	return attr, nil
+}
+
+// bufferAttrChanged is called when the server changed the buffer attributes.
+// The buffers used by the reader goroutine are resized by the goroutine itself.
+func (p *PlaybackStream) bufferAttrChanged(attr PlaybackBufferAttr, sinkLatency proto.Microseconds) {
+	p.bufferLock.Lock()
+	p.createReply.BufferMaxLength = attr.MaxLength
+	p.createReply.BufferTargetLength = attr.TargetLength
+	p.createReply.BufferPrebufferLength = attr.Prebuffer
+	p.createReply.BufferMinimumRequest = attr.MinimumRequest
+	p.createReply.SinkLatency = sinkLatency
+	p.bufferLock.Unlock()
+}
+
+func (p *PlaybackStream) durationToBytes(d time.Duration) uint32 {
+	frames := uint64(d) * uint64(p.rate()) / uint64(time.Second)
+	return uint32(frames) * uint32(p.createReply.Channels) * uint32(p.bytesPerSample)
+}
+
+// BufferAttr returns the current buffer attributes of the stream.
+func (r *RecordStream) BufferAttr() RecordBufferAttr {
+	r.bufferLock.Lock()
+	defer r.bufferLock.Unlock()
+	return RecordBufferAttr{
+		MaxLength:    r.createReply.BufferMaxLength,
+		FragmentSize: r.createReply.BufferFragSize,
+	}
+}
+
+// SetBufferAttr changes the buffer attributes of a stream that is already running.
+// The server may not be able to use the requested values exactly, the values actually used are returned.
+func (r *RecordStream) SetBufferAttr(attr RecordBufferAttr) (RecordBufferAttr, error) {
+	return r.setBufferAttr(attr, false)
+}
+
+// SetLatency changes the latency of a stream that is already running, like the RecordLatency option.
+// The resulting buffer attributes are returned.
+func (r *RecordStream) SetLatency(latency time.Duration) (RecordBufferAttr, error) {
+	frames := uint64(latency) * uint64(r.rate()) / uint64(time.Second)
+	frag := uint32(frames) * uint32(r.createReply.Channels) * uint32(r.bytesPerSample)
+	return r.setBufferAttr(RecordBufferAttr{MaxLength: 2 * frag, FragmentSize: frag}, true)
+}
+
+func (r *RecordStream) setBufferAttr(attr RecordBufferAttr, adjustLatency bool) (RecordBufferAttr, error) {
+	var rpl proto.SetRecordStreamBufferAttrReply
+	err := r.c.request(&proto.SetRecordStreamBufferAttr{
+		StreamIndex:     r.index,
+		BufferMaxLength: attr.MaxLength,
+		BufferFragSize:  attr.FragmentSize,
+		AdjustLatency:   adjustLatency,
+	}, &rpl)
+	if err != nil {
+		return RecordBufferAttr{}, err
+	}
+	attr = RecordBufferAttr{MaxLength: rpl.BufferMaxLength, FragmentSize: rpl.BufferFragSize}
+	r.bufferAttrChanged(attr, rpl.SourceLatency)
+	return attr, nil
+}
+
+// bufferAttrChanged is called when the server changed the buffer attributes.
+func (r *RecordStream) bufferAttrChanged(attr RecordBufferAttr, sourceLatency proto.Microseconds) {
+	r.bufferLock.Lock()
+	r.createReply.BufferMaxLength = attr.MaxLength
+	r.createReply.BufferFragSize = attr.FragmentSize
+	r.createReply.SourceLatency = sourceLatency
+	r.bufferLock.Unlock()
+	if r.w == nil {
+		r.pullLock.Lock()
+		r.ring.resize(r.ringCapacity())
+		r.pullLock.Unlock()
+	}
+}
+
+// ringCapacity returns the size of the buffer used by Read.
+// Unless the size was set explicitly, the buffer holds one second of audio, but at least one fragment.
+func (r *RecordStream) ringCapacity() int {
+	frame := r.bytesPerSample * int(r.createReply.Channels)
+	size := r.ringSize
+	if size == 0 {
+		size = int(r.rate()) * frame
+		if frag := int(r.BufferAttr().FragmentSize); size < frag {
+			size = frag
+		}
+	}
+	// Round up to whole frames, so that the buffer holds at least one frame.
+	return size + (frame-size%frame)%frame
+}
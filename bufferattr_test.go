@@ -0,0 +1,98 @@
+package pulse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackSetBufferAttr(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpSetPlaybackStreamBufferAttr {
+			args = a
+			// The server doesn't grant the requested maximum length.
+			c.reply(tag, new(tags).u32(a[1].(uint32)/2).u32(a[2].(uint32)).u32(a[2].(uint32)).u32(400).usec(5000))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPlayback(Int16Reader(func(buf []int16) (int, error) {
+		return len(buf), nil
+	}), PlaybackStereo, PlaybackSampleRate(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attr, err := p.SetLatency(100 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[1] != uint32(8000) || args[2] != uint32(4000) || args[3] != uint32(proto.Undefined) || args[5] != true {
+		t.Errorf("unexpected request %v", args)
+	}
+	if attr != (PlaybackBufferAttr{MaxLength: 4000, TargetLength: 4000, Prebuffer: 4000, MinimumRequest: 400}) {
+		t.Errorf("unexpected buffer attributes %+v", attr)
+	}
+	if p.BufferSizeBytes() != 4000 || p.BufferSize() != 1000 {
+		t.Errorf("expected buffer size 4000 bytes, got %d", p.BufferSizeBytes())
+	}
+
+	// The server may change the buffer at any time, the reader must be able to fill the larger buffer.
+	s.send(proto.OpPlaybackBufferAttrChanged, new(tags).u32(p.StreamIndex()).u32(40000).u32(20000).u32(20000).u32(400).usec(5000))
+	waitFor(t, func() bool { return p.BufferSizeBytes() == 20000 })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s.send(proto.OpRequest, new(tags).u32(p.StreamIndex()).u32(40000-20000))
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 40000 })
+}
+
+func TestRecordSetBufferAttr(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpSetRecordStreamBufferAttr {
+			c.reply(tag, new(tags).u32(a[1].(uint32)).u32(a[2].(uint32)).usec(5000))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatUint8, RecordSampleRate(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	capacity := func() int {
+		r.pullLock.Lock()
+		defer r.pullLock.Unlock()
+		return len(r.ring.buf)
+	}
+	if capacity() != 1000 {
+		t.Errorf("expected a buffer of 1000 bytes, got %d", capacity())
+	}
+
+	attr, err := r.SetBufferAttr(RecordBufferAttr{MaxLength: 4000, FragmentSize: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr != (RecordBufferAttr{MaxLength: 4000, FragmentSize: 2000}) || r.BufferAttr() != attr {
+		t.Errorf("unexpected buffer attributes %+v", attr)
+	}
+	// The buffer must hold at least one fragment.
+	if capacity() != 2000 {
+		t.Errorf("expected a buffer of 2000 bytes, got %d", capacity())
+	}
+
+	s.send(proto.OpRecordBufferAttrChanged, new(tags).u32(r.StreamIndex()).u32(6000).u32(3000).usec(5000))
+	waitFor(t, func() bool { return capacity() == 3000 })
+	if r.BufferAttr().MaxLength != 6000 {
+		t.Errorf("expected maximum length 6000, got %d", r.BufferAttr().MaxLength)
+	}
+}
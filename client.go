@@ -1,11 +1,16 @@
 package pulse
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"path"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jfreymuth/pulse/proto"
@@ -19,15 +24,23 @@ type Client struct {
 	mu       sync.Mutex
 	playback map[uint32]*PlaybackStream
 	record   map[uint32]*RecordStream
+	closed   bool            // protected by mu
+	syncID   uint32          // protected by mu
+	wg       sync.WaitGroup  // background goroutines of streams
+	owned    map[uint64]bool // ids of the goroutines that run callbacks, protected by mu
+	readLoop sync.Once       // registers the read loop in owned
 
-	server  string
-	props   proto.PropList
-	timeout time.Duration
+	server   string
+	props    proto.PropList
+	timeout  time.Duration
+	logger   proto.Logger
+	observer proto.Observer
 }
 
 // NewClient connects to the server.
 func NewClient(opts ...ClientOption) (*Client, error) {
 	c := &Client{
+		owned: make(map[uint64]bool),
 		props: proto.PropList{
 			"media.name":                 proto.PropListString("go audio"),
 			"application.name":           proto.PropListString(path.Base(os.Args[0])),
@@ -42,7 +55,8 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	}
 
 	var err error
-	c.c, c.conn, err = proto.Connect(c.server)
+	c.c = &proto.Client{Logger: c.logger, Observer: c.observer}
+	c.conn, err = c.c.Dial(c.server)
 	if err != nil {
 		return nil, err
 	}
@@ -51,14 +65,14 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 		c.c.SetTimeout(c.timeout)
 	}
 
-	err = c.c.Request(&proto.SetClientName{Props: c.props}, &proto.SetClientNameReply{})
+	err = c.request(&proto.SetClientName{Props: c.props}, &proto.SetClientNameReply{})
 	if err != nil {
 		c.conn.Close()
 		return nil, err
 	}
 
-	// Listen for changes to the sink input, which includes changes in volume.
-	err = c.c.Request(&proto.Subscribe{Mask: proto.SubscriptionMaskSinkInput}, nil)
+	// Listen for changes to sink inputs and source outputs, which includes changes in volume.
+	err = c.request(&proto.Subscribe{Mask: proto.SubscriptionMaskSinkInput | proto.SubscriptionMaskSourceInput}, nil)
 	if err != nil {
 		c.conn.Close()
 		return nil, err
@@ -67,13 +81,22 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	c.playback = make(map[uint32]*PlaybackStream)
 	c.record = make(map[uint32]*RecordStream)
 	c.c.Callback = func(msg interface{}) {
+		// The callback runs on the read loop, which also calls the writers of record streams.
+		// Only ConnectionClosed can also be sent from a failed write on another goroutine.
+		if _, ok := msg.(*proto.ConnectionClosed); !ok {
+			c.readLoop.Do(func() {
+				c.mu.Lock()
+				c.owned[goid()] = true
+				c.mu.Unlock()
+			})
+		}
 		switch msg := msg.(type) {
 		case *proto.Request:
 			c.mu.Lock()
 			stream, ok := c.playback[msg.StreamIndex]
 			c.mu.Unlock()
 			if ok {
-				stream.request <- int(msg.Length)
+				stream.requestData(int(msg.Length))
 			}
 		case *proto.DataPacket:
 			c.mu.Lock()
@@ -86,28 +109,125 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 			c.mu.Lock()
 			stream, ok := c.playback[msg.StreamIndex]
 			c.mu.Unlock()
-			if ok && stream.state.is(running) && !stream.underflow {
-				stream.started <- true
+			if ok {
+				atomic.StoreInt32(&stream.playing, 1)
+			}
+			if ok && stream.state.is(running) && !stream.Underflow() {
+				select {
+				case stream.started <- true:
+				default:
+				}
 			}
 		case *proto.Underflow:
 			c.mu.Lock()
 			stream, ok := c.playback[msg.StreamIndex]
 			c.mu.Unlock()
 			if ok {
+				atomic.StoreInt32(&stream.playing, 0)
 				if stream.state.is(running) {
-					stream.underflow = true
+					stream.underflowed(msg.Offset)
+				}
+				if stream.observer != nil {
+					stream.observer.Underflow(msg.StreamIndex)
+				}
+			}
+		case *proto.Overflow:
+			// The server only reports overflows of playback streams, i.e. more data was written than requested.
+			c.mu.Lock()
+			stream, ok := c.playback[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.overflowed()
+				if stream.observer != nil {
+					stream.observer.Overflow(msg.StreamIndex)
 				}
 			}
+		case *proto.PlaybackBufferAttrChanged:
+			c.mu.Lock()
+			stream, ok := c.playback[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.bufferAttrChanged(PlaybackBufferAttr{
+					MaxLength:      msg.BufferMaxLength,
+					TargetLength:   msg.BufferTargetLength,
+					Prebuffer:      msg.BufferPrebufferLength,
+					MinimumRequest: msg.BufferMinimumRequest,
+				}, msg.SinkLatency)
+			}
+		case *proto.RecordBufferAttrChanged:
+			c.mu.Lock()
+			stream, ok := c.record[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.bufferAttrChanged(RecordBufferAttr{
+					MaxLength:    msg.BufferMaxLength,
+					FragmentSize: msg.BufferFragSize,
+				}, msg.SourceLatency)
+			}
+		case *proto.PlaybackStreamMoved:
+			c.mu.Lock()
+			stream, ok := c.playback[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.moved(msg)
+			}
+		case *proto.RecordStreamMoved:
+			c.mu.Lock()
+			stream, ok := c.record[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.moved(msg)
+			}
+		case *proto.PlaybackStreamSuspended:
+			c.mu.Lock()
+			stream, ok := c.playback[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.suspended(msg.Suspended)
+			}
+		case *proto.RecordStreamSuspended:
+			c.mu.Lock()
+			stream, ok := c.record[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.suspended(msg.Suspended)
+			}
+		case *proto.PlaybackStreamEvent:
+			c.mu.Lock()
+			stream, ok := c.playback[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.event(msg)
+			}
+		case *proto.PlaybackStreamKilled:
+			c.mu.Lock()
+			stream, ok := c.playback[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.killed()
+			}
+		case *proto.RecordStreamKilled:
+			c.mu.Lock()
+			stream, ok := c.record[msg.StreamIndex]
+			c.mu.Unlock()
+			if ok {
+				stream.killed()
+			}
 		case *proto.ConnectionClosed:
 			c.mu.Lock()
+			// The error is set first, so that it is visible as soon as the stream is closed.
+			// Streams that are being closed by Close are released there.
 			for _, p := range c.playback {
-				close(p.request)
-				p.err = ErrConnectionClosed
-				p.state.set(serverLost)
+				p.err.set(ErrConnectionClosed)
+				if p.state.setIfNot(serverLost, closed, serverLost, killed) {
+					p.release()
+				}
 			}
 			for _, r := range c.record {
-				r.err = ErrConnectionClosed
-				r.state = serverLost
+				r.err.set(ErrConnectionClosed)
+				if r.state.setIfNot(serverLost, closed, serverLost, killed) {
+					r.release()
+				}
 			}
 			c.playback = make(map[uint32]*PlaybackStream)
 			c.record = make(map[uint32]*RecordStream)
@@ -140,6 +260,27 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 					stream.eventsLock.Unlock()
 				}
 			}
+			if msg.Event&proto.EventFacilityMask == proto.EventSinkSourceOutput {
+				// The same for record streams.
+				var stream *RecordStream
+				c.mu.Lock()
+				for _, v := range c.record {
+					if msg.Index == v.createReply.SourceOutputIndex {
+						stream = v
+					}
+				}
+				c.mu.Unlock()
+				if stream != nil {
+					stream.eventsLock.Lock()
+					if stream.events != nil {
+						select {
+						case stream.events <- struct{}{}:
+						default:
+						}
+					}
+					stream.eventsLock.Unlock()
+				}
+			}
 		default:
 			//fmt.Printf("%#v\n", msg)
 		}
@@ -148,9 +289,122 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	return c, nil
 }
 
-// Close closes the client. Calling methods on a closed client may panic.
-func (c *Client) Close() {
-	c.conn.Close()
+// Close closes the client.
+// All streams are closed, and Close waits until all goroutines started by the client have exited.
+// This includes waiting for currently running stream callbacks to return.
+// If Close is called from a callback, e.g. a Reader, a Writer or the function set with PlaybackOnEnd,
+// it can't wait for its own goroutine and returns without waiting.
+// Methods called on a closed client return ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	wait := !c.owned[goid()]
+	if c.closed {
+		c.mu.Unlock()
+		// Another call to Close is closing the client, wait for it to finish.
+		if wait {
+			<-c.c.Done()
+			c.wg.Wait()
+		}
+		return nil
+	}
+	// From now on, requests fail and no new streams are added.
+	c.closed = true
+	playback := make([]*PlaybackStream, 0, len(c.playback))
+	for _, p := range c.playback {
+		playback = append(playback, p)
+	}
+	record := make([]*RecordStream, 0, len(c.record))
+	for _, r := range c.record {
+		record = append(record, r)
+	}
+	c.mu.Unlock()
+
+	var err error
+	if !wait {
+		// A callback may block the read loop, so the replies to the delete requests would never arrive.
+		// Closing the connection first makes the requests fail immediately.
+		err = c.conn.Close()
+	}
+	// The streams bypass the closed flag to delete themselves, see deleteStream.
+	// Errors are ignored here, the streams are closed locally in any case
+	// and will be removed by the server when the connection is closed.
+	for _, p := range playback {
+		p.Close()
+	}
+	for _, r := range record {
+		r.Close()
+	}
+
+	if wait {
+		err = c.conn.Close()
+		<-c.c.Done()
+		c.wg.Wait()
+	}
+	return err
+}
+
+func (c *Client) request(req proto.RequestArgs, rpl proto.Reply) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	return c.c.Request(req, rpl)
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// deleteStream is like request, but also works while the client is being closed.
+func (c *Client) deleteStream(req proto.RequestArgs) error {
+	return c.c.Request(req, nil)
+}
+
+// requestContext is like request, but does not use the client's timeout.
+func (c *Client) requestContext(ctx context.Context, req proto.RequestArgs, rpl proto.Reply) error {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	return c.c.RequestContext(ctx, req, rpl)
+}
+
+func (c *Client) newSyncID() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.syncID
+	c.syncID++
+	return id
+}
+
+// goroutine starts a background goroutine that Close will wait for.
+func (c *Client) goroutine(f func()) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		id := goid()
+		c.mu.Lock()
+		c.owned[id] = true
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			delete(c.owned, id)
+			c.mu.Unlock()
+		}()
+		f()
+	}()
+}
+
+// goid returns the id of the current goroutine.
+// It is only used to detect calls to Close from callbacks, see (*Client).Close.
+func goid() uint64 {
+	var buf [64]byte
+	s := strings.TrimPrefix(string(buf[:runtime.Stack(buf[:], false)]), "goroutine ")
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	id, _ := strconv.ParseUint(s, 10, 64)
+	return id
 }
 
 // A ClientOption supplies configuration when creating the client.
@@ -184,22 +438,73 @@ func ClientTimeout(d time.Duration) ClientOption {
 	}
 }
 
+// ClientLogger sets a logger that receives diagnostic messages, for example about unknown messages
+// from the server or stream state changes.
+// By default, nothing is logged.
+func ClientLogger(l proto.Logger) ClientOption {
+	return func(c *Client) { c.logger = l }
+}
+
+// ClientObserver sets an observer that receives measurements of requests and of the data sent and received.
+// See PlaybackObserver and RecordObserver for measurements concerning individual streams.
+func ClientObserver(o proto.Observer) ClientOption {
+	return func(c *Client) { c.observer = o }
+}
+
 // RawRequest can be used to send arbitrary requests.
 //
 // req should be one of the request types defined by the proto package.
 //
 // rpl must be a pointer to the correct reply type or nil. This funcion will panic if rpl has the wrong type.
 //
-// The returned error can be compared against errors defined by the proto package to check for specific errors.
+// If the server replies with an error, the returned error is a *proto.RequestError.
+// Use errors.Is to check for specific errors defined by the proto package, e.g. errors.Is(err, proto.ErrNoSuchEntity),
+// or errors.As to get the details of the failed request.
 //
 // The function will always block until the server has replied, even if rpl is nil.
 func (c *Client) RawRequest(req proto.RequestArgs, rpl proto.Reply) error {
-	return c.c.Request(req, rpl)
+	return c.request(req, rpl)
 }
 
 // ErrConnectionClosed is a special error value indicating that the server closed the connection.
 const ErrConnectionClosed = pulseError("pulseaudio: connection closed")
 
+// ErrClientClosed is returned by methods called after the client was closed.
+const ErrClientClosed = pulseError("pulse: client closed")
+
+// ErrEncodingNotSupported is returned by NewPassthroughPlayback if the server chose a different encoding.
+const ErrEncodingNotSupported = pulseError("pulse: encoding not supported")
+
+// ErrDrainInterrupted is returned by Drain if the stream was paused, stopped, flushed or closed before all data was played.
+const ErrDrainInterrupted = pulseError("pulse: drain interrupted")
+
+// ErrStreamKilled is returned when using a stream that was removed by the server, see StreamKilled.
+const ErrStreamKilled = pulseError("pulse: stream killed")
+
+// ErrStreamClosed is returned when writing to a closed stream.
+const ErrStreamClosed = pulseError("pulse: stream closed")
+
+// ErrPullStream is returned when calling Write on a stream that is not created with NewPushPlayback.
+const ErrPullStream = pulseError("pulse: stream uses a reader")
+
+// ErrPushStream is returned when calling Read on a stream that is not created with NewPullRecord.
+const ErrPushStream = pulseError("pulse: stream uses a writer")
+
+// ErrOverflow is returned by Read if recorded data was lost because it was not read fast enough.
+const ErrOverflow = pulseError("pulse: overflow")
+
+// ErrWrongFormat is returned by typed read or write methods if the stream uses a different sample format.
+const ErrWrongFormat = pulseError("pulse: wrong sample format")
+
+// ErrInvalidTarget is returned by (*DriftController).Update if the target level is not positive.
+const ErrInvalidTarget = pulseError("pulse: invalid target level")
+
+func (c *Client) logStateChange(stream string, index uint32, from, to streamState) {
+	if c.logger != nil && from != to {
+		c.logger.Log(proto.LevelDebug, "pulse: stream state changed", "stream", stream, "index", index, "from", from.String(), "to", to.String())
+	}
+}
+
 type pulseError string
 
 func (e pulseError) Error() string { return string(e) }
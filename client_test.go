@@ -0,0 +1,136 @@
+package pulse
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestClientClose(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+
+	volumeChanges := make(chan proto.ChannelVolumes, 1)
+	p, err := c.NewPlayback(Float32Reader(func(buf []float32) (int, error) { return len(buf), nil }), PlaybackVolumeChanges(volumeChanges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewRecord(Float32Writer(func(buf []float32) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+	checkGoroutines(t)
+
+	if s.received(proto.OpDeletePlaybackStream) != 1 || s.received(proto.OpDeleteRecordStream) != 1 {
+		t.Error("streams were not deleted")
+	}
+	if !p.Closed() || !r.Closed() {
+		t.Error("streams should be closed")
+	}
+	if _, ok := <-volumeChanges; ok {
+		t.Error("volume changes channel should be closed")
+	}
+	if _, err := c.ListSinks(); err != ErrClientClosed {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+	if _, err := c.NewPlayback(Float32Reader(nil)); err != ErrClientClosed {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("closing twice: %v", err)
+	}
+}
+
+func TestClientCloseConcurrent(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+
+	var wg sync.WaitGroup
+	streams := make(chan *PlaybackStream, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if p, err := c.NewPlayback(Float32Reader(func(buf []float32) (int, error) { return len(buf), nil })); err == nil {
+				streams <- p
+			} else if err != ErrClientClosed {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+	close(streams)
+	// Every stream that was created before the client was closed must be closed by Close.
+	for p := range streams {
+		if !p.Closed() {
+			t.Errorf("stream %d was not closed", p.StreamIndex())
+		}
+	}
+	checkGoroutines(t)
+}
+
+func TestClientCloseFromCallback(t *testing.T) {
+	for name, start := range map[string]func(s *testServer, c *Client, close func()) error{
+		"reader": func(s *testServer, c *Client, close func()) error {
+			p, err := c.NewPlayback(Float32Reader(func(buf []float32) (int, error) {
+				close()
+				return len(buf), nil
+			}))
+			if err != nil {
+				return err
+			}
+			return p.Start()
+		},
+		"on end": func(s *testServer, c *Client, close func()) error {
+			p, err := c.NewPlayback(Float32Reader(func(buf []float32) (int, error) { return 0, EndOfData }),
+				PlaybackOnEnd(func(error) { close() }))
+			if err != nil {
+				return err
+			}
+			return p.Start()
+		},
+		"writer": func(s *testServer, c *Client, close func()) error {
+			r, err := c.NewRecord(Float32Writer(func(buf []float32) (int, error) {
+				close()
+				return len(buf), nil
+			}))
+			if err != nil {
+				return err
+			}
+			if err := r.Start(); err != nil {
+				return err
+			}
+			s.conns[0].sendData(r.StreamIndex(), make([]byte, 4))
+			return nil
+		},
+	} {
+		s := newTestServer(t)
+		c := s.client()
+		done := make(chan error, 1)
+		var once sync.Once
+		// Start can fail because the client is closed while it is waiting for a reply.
+		start(s, c, func() { once.Do(func() { done <- c.Close() }) })
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("%s: Close did not return", name)
+		}
+		c.Close()
+	}
+}
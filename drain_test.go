@@ -0,0 +1,162 @@
+package pulse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackDrain(t *testing.T) {
+	s := newTestServer(t)
+	drainTime := 100 * time.Millisecond
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpDrainPlaybackStream {
+			// Reply when the buffer would be empty.
+			time.AfterFunc(drainTime, func() { c.reply(tag, new(tags)) })
+			return true
+		}
+		return false
+	}
+	c := s.client(ClientTimeout(20 * time.Millisecond))
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Drain(); err != nil {
+		t.Errorf("draining an idle stream: %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Draining is not limited by the client's timeout.
+	if err := p.Drain(); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.DrainContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	result := p.DrainAsync()
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != ErrDrainInterrupted {
+		t.Errorf("expected ErrDrainInterrupted, got %v", err)
+	}
+	if err := p.Drain(); err != ErrDrainInterrupted {
+		t.Errorf("expected ErrDrainInterrupted for a paused stream, got %v", err)
+	}
+}
+
+func TestPlaybackDrainFlushed(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpDrainPlaybackStream {
+			c.error(tag, proto.ErrNoSuchEntity)
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Drain(); err != ErrDrainInterrupted {
+		t.Errorf("expected ErrDrainInterrupted, got %v", err)
+	}
+}
+
+func TestPlaybackDrainError(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpDrainPlaybackStream {
+			c.error(tag, proto.ErrAccessDenied)
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Other errors are returned unchanged.
+	var reqErr *proto.RequestError
+	if err := p.Drain(); !errors.As(err, &reqErr) || !errors.Is(err, proto.ErrAccessDenied) {
+		t.Errorf("expected the server's error, got %v", err)
+	}
+}
+
+func TestPlaybackDrainEnded(t *testing.T) {
+	s := newTestServer(t)
+	drained := make(chan struct{})
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpDrainPlaybackStream {
+			go func() {
+				<-drained
+				c.reply(tag, new(tags))
+			}()
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	clip := make([]int16, 100)
+	p, err := c.NewPlayback(Int16Reader(func(buf []int16) (int, error) {
+		n := copy(buf, clip)
+		clip = clip[n:]
+		return n, EndOfData
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return !p.Running() })
+
+	// The stream is idle, but the server is still playing the data.
+	result := p.DrainAsync()
+	waitFor(t, func() bool { return s.received(proto.OpDrainPlaybackStream) == 1 })
+	select {
+	case err := <-result:
+		t.Fatalf("drain returned before the data was played: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	drained <- struct{}{}
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+
+	// After Stop, the remaining data is not drained.
+	p.Stop()
+	if err := p.Drain(); err != nil {
+		t.Error(err)
+	}
+	if n := s.received(proto.OpDrainPlaybackStream); n != 1 {
+		t.Errorf("expected 1 drain request, got %d", n)
+	}
+	close(drained)
+}
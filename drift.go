@@ -0,0 +1,90 @@
+package pulse
+
+import "math"
+
+// A DriftController compensates for clock drift between the source of the audio and the sink
+// by adjusting the sample rate of a stream.
+//
+// The audio is typically received into a buffer (e.g. the jitter buffer of a network stream)
+// from which the stream's reader takes its data. If the sink consumes the audio too slowly, the buffer
+// fills up, if it consumes the audio too quickly, the buffer runs empty. The controller measures
+// the fill level of the buffer and changes the sample rate to keep the level near a target.
+//
+// The stream must be created with the PlaybackVariableRate option.
+type DriftController struct {
+	// Target is the desired fill level of the buffer.
+	// Target and the levels passed to Update can use any unit, e.g. frames or bytes.
+	Target int
+	// MaxDeviation is the maximum relative deviation from the nominal sample rate. The default is 0.01 (1%).
+	MaxDeviation float64
+	// Proportional and Integral are the gains of the controller. They are relative to Target,
+	// e.g. with a Proportional gain of 0.01, a buffer that is twice as full as it should be
+	// increases the sample rate by 1%. Integral is added up on every call to Update.
+	Proportional, Integral float64
+
+	p        *PlaybackStream
+	nominal  float64
+	integral float64
+	rate     int
+}
+
+// NewDriftController creates a drift controller for a stream.
+// The stream's current sample rate is used as the nominal rate. The target must be positive.
+func NewDriftController(p *PlaybackStream, target int) *DriftController {
+	if target <= 0 {
+		panic("pulse: invalid drift controller target")
+	}
+	rate := p.SampleRate()
+	return &DriftController{
+		Target:       target,
+		MaxDeviation: 0.01,
+		Proportional: 0.005,
+		Integral:     0.0001,
+		p:            p,
+		nominal:      float64(rate),
+		rate:         rate,
+	}
+}
+
+// Update adjusts the sample rate of the stream according to the current fill level of the buffer.
+// It should be called at regular intervals, e.g. every time data is added to the buffer.
+// A request is only sent to the server if the sample rate actually changes.
+// Update returns ErrInvalidTarget if Target was changed to a value that is not positive.
+func (d *DriftController) Update(level int) error {
+	if d.Target <= 0 {
+		return ErrInvalidTarget
+	}
+	e := float64(level-d.Target) / float64(d.Target)
+	d.integral = clamp(d.integral+d.Integral*e, d.MaxDeviation)
+	adjust := clamp(d.Proportional*e+d.integral, d.MaxDeviation)
+	rate := int(math.Round(d.nominal * (1 + adjust)))
+	if rate == d.rate {
+		return nil
+	}
+	if err := d.p.SetSampleRate(rate); err != nil {
+		return err
+	}
+	d.rate = rate
+	return nil
+}
+
+// Rate returns the sample rate that was last set by the controller.
+func (d *DriftController) Rate() int { return d.rate }
+
+// Reset sets the stream back to its nominal sample rate and resets the controller's state.
+func (d *DriftController) Reset() error {
+	d.integral = 0
+	rate := int(d.nominal)
+	if rate == d.rate {
+		return nil
+	}
+	if err := d.p.SetSampleRate(rate); err != nil {
+		return err
+	}
+	d.rate = rate
+	return nil
+}
+
+func clamp(x, limit float64) float64 {
+	return math.Max(-limit, math.Min(limit, x))
+}
@@ -0,0 +1,80 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestDriftController(t *testing.T) {
+	s := newTestServer(t)
+	var variableRate bool
+	var rates []uint32
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpCreatePlaybackStream:
+			variableRate = a[17].(bool)
+		case proto.OpUpdatePlaybackStreamSampleRate:
+			rates = append(rates, a[1].(uint32))
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackSampleRate(48000), PlaybackVariableRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !variableRate {
+		t.Error("variable rate flag was not set")
+	}
+
+	d := NewDriftController(p, 1000)
+	// At the target level, nothing happens.
+	if err := d.Update(1000); err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 0 {
+		t.Errorf("unexpected rate change %v", rates)
+	}
+
+	// A full buffer speeds up playback.
+	if err := d.Update(2000); err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0] <= 48000 || p.SampleRate() != int(rates[0]) || d.Rate() != p.SampleRate() {
+		t.Errorf("expected a higher rate, got %v", rates)
+	}
+
+	// The deviation is limited.
+	for i := 0; i < 1000; i++ {
+		if err := d.Update(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.SampleRate() != 47520 {
+		t.Errorf("expected rate 47520, got %d", p.SampleRate())
+	}
+
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if p.SampleRate() != 48000 {
+		t.Errorf("expected rate 48000, got %d", p.SampleRate())
+	}
+
+	d.Target = 0
+	if err := d.Update(1000); err != ErrInvalidTarget {
+		t.Errorf("expected ErrInvalidTarget, got %v", err)
+	}
+	if p.SampleRate() != 48000 {
+		t.Errorf("rate changed to %d", p.SampleRate())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid target did not panic")
+		}
+	}()
+	NewDriftController(p, 0)
+}
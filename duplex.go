@@ -0,0 +1,418 @@
+package pulse
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// A Duplex is a record stream and a playback stream that are processed together,
+// e.g. for effects processors or echo cancellation.
+// The recorded audio is passed to a processing function in periods of fixed size,
+// and the processed audio is played immediately.
+//
+// Both streams use the native float32 format and the same sample rate.
+// Playback is delayed so that the time between recording and playing a sample is constant, see Latency.
+type Duplex struct {
+	// 64-bit values accessed atomically come first, so that they are aligned on 32-bit platforms.
+	gen        int64 // incremented by Start and Stop to discard partially recorded periods
+	overflows  int64
+	underflows int64
+
+	c       *Client
+	r       *RecordStream
+	p       *PlaybackStream
+	process func(in, out [][]float32)
+
+	rate        int
+	inMap       proto.ChannelMap
+	outMap      proto.ChannelMap
+	period      int // in frames
+	latency     time.Duration
+	recordOpts  []RecordOption
+	playOpts    []PlaybackOption
+	xrunChanges chan<- DuplexXrun
+
+	writeMu sync.Mutex // held while a period is sent, so that gen doesn't change during the send
+
+	mu       sync.Mutex
+	measured time.Duration // protected by mu
+}
+
+// A DuplexXrun describes a dropout of a Duplex.
+type DuplexXrun int
+
+const (
+	// InputOverflow means that recorded audio was lost because the processing function did not keep up.
+	InputOverflow DuplexXrun = iota
+	// OutputUnderflow means that the server ran out of audio to play.
+	OutputUnderflow
+)
+
+func (x DuplexXrun) String() string {
+	switch x {
+	case InputOverflow:
+		return "input overflow"
+	case OutputUnderflow:
+		return "output underflow"
+	}
+	return "invalid"
+}
+
+// A DuplexOption supplies configuration when creating a duplex stream.
+type DuplexOption func(*Duplex)
+
+// NewDuplex creates a record stream and a playback stream that are processed by the function process.
+// process is called once per period, in contains the recorded audio and out must be filled with the audio to play.
+// Both are slices of channels, each channel contains one period of samples.
+//
+// The streams wil not be running, they must be started with Start().
+// NewDuplex panics if process is nil or the period is not positive.
+func (c *Client) NewDuplex(process func(in, out [][]float32), opts ...DuplexOption) (*Duplex, error) {
+	if process == nil {
+		panic("pulse: invalid duplex processing function")
+	}
+	d := &Duplex{
+		c:       c,
+		process: process,
+		rate:    44100,
+		inMap:   proto.ChannelMap{proto.ChannelMono},
+		outMap:  proto.ChannelMap{proto.ChannelMono},
+		latency: 40 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.period == 0 {
+		d.period = d.rate / 100
+	}
+	if d.period <= 0 {
+		panic("pulse: invalid duplex period")
+	}
+	const frameSize = 4
+	inFrame, outFrame := frameSize*len(d.inMap), frameSize*len(d.outMap)
+
+	recordOpts := append([]RecordOption{
+		RecordChannels(d.inMap),
+		RecordSampleRate(d.rate),
+		RecordBufferFragmentSize(uint32(d.period * inFrame)),
+		RecordReadBufferSize(4 * d.period * inFrame),
+		RecordOverflowPolicy(OverflowError),
+		func(r *RecordStream) { r.createRequest.AdjustLatency = true },
+	}, d.recordOpts...)
+	recordOpts = append(recordOpts, func(r *RecordStream) {
+		r.observer = duplexObserver{observer(r.observer), d, true}
+	})
+	r, err := c.NewPullRecord(formatF32, recordOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	target := uint32(int64(d.latency)*int64(d.rate)/int64(time.Second)) * uint32(outFrame)
+	playOpts := append([]PlaybackOption{
+		PlaybackChannels(d.outMap),
+		PlaybackSampleRate(d.rate),
+		func(p *PlaybackStream) {
+			p.createRequest.BufferTargetLength = target
+			p.createRequest.BufferMinimumRequest = uint32(d.period * outFrame)
+			// Play immediately after an underflow, so that the latency stays the same.
+			p.createRequest.BufferPrebufferLength = 0
+			p.createRequest.AdjustLatency = true
+		},
+	}, d.playOpts...)
+	playOpts = append(playOpts, func(p *PlaybackStream) {
+		p.observer = duplexObserver{observer(p.observer), d, false}
+	})
+	p, err := c.NewPushPlayback(formatF32, playOpts...)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	d.r, d.p = r, p
+	c.goroutine(d.run)
+	return d, nil
+}
+
+// run calls the processing function until the record stream is closed.
+func (d *Duplex) run() {
+	inCh, outCh := len(d.inMap), len(d.outMap)
+	inBuf := make([]float32, d.period*inCh)
+	outBuf := make([]float32, d.period*outCh)
+	in := make([][]float32, inCh)
+	for i := range in {
+		in[i] = make([]float32, d.period)
+	}
+	out := make([][]float32, outCh)
+	for i := range out {
+		out[i] = make([]float32, d.period)
+	}
+
+	for {
+		var gen int64
+		for n := 0; n < len(inBuf); {
+			m, err := d.r.ReadFloat32(inBuf[n:])
+			if err == ErrOverflow {
+				// The overflow was reported by duplexObserver. Start the period again with new data.
+				n = 0
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if g := atomic.LoadInt64(&d.gen); g != gen {
+				// The streams were restarted, discard data from the previous run.
+				copy(inBuf, inBuf[n:n+m])
+				n = 0
+				gen = g
+			}
+			n += m
+		}
+
+		for i, s := range inBuf {
+			in[i%inCh][i/inCh] = s
+		}
+		d.process(in, out)
+		for i := range outBuf {
+			outBuf[i] = out[i%outCh][i/outCh]
+		}
+		if err := d.write(float32Bytes(outBuf), gen); err != nil {
+			return
+		}
+	}
+}
+
+// write plays a period that was recorded in generation gen.
+// The period is dropped if the streams are stopped or restarted in the meantime,
+// otherwise it would be played after the silence written by Start.
+func (d *Duplex) write(buf []byte, gen int64) error {
+	p := d.p
+	frame := 4 * len(d.outMap)
+	for len(buf) > 0 {
+		p.pushLock.Lock()
+		for p.writable < frame && !p.Closed() && atomic.LoadInt64(&d.gen) == gen {
+			p.pushCond.Wait()
+		}
+		p.pushLock.Unlock()
+		if p.Closed() {
+			return ErrStreamClosed
+		}
+
+		d.writeMu.Lock()
+		if atomic.LoadInt64(&d.gen) != gen {
+			d.writeMu.Unlock()
+			return nil
+		}
+		p.pushLock.Lock()
+		n := p.writable
+		if n > len(buf) {
+			n = len(buf)
+		}
+		n -= n % frame
+		p.writable -= n
+		p.pushLock.Unlock()
+		err := p.c.c.Send(p.index, buf[:n])
+		d.writeMu.Unlock()
+		if err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// restart discards the recorded audio and the period that is waiting to be played.
+func (d *Duplex) restart() {
+	d.writeMu.Lock()
+	atomic.AddInt64(&d.gen, 1)
+	d.writeMu.Unlock()
+	d.p.wakeWriters()
+}
+
+// Start starts both streams.
+// Before playback starts, the latency of the sink and the source is measured, and silence is played
+// so that the time between recording and playing each sample is the latency set with DuplexLatency.
+func (d *Duplex) Start() error {
+	if d.r.Running() {
+		return nil
+	}
+	source, err := d.sourceLatency()
+	if err != nil {
+		return err
+	}
+	if err := d.p.UpdateTiming(); err != nil {
+		return err
+	}
+	d.p.timingLock.Lock()
+	sink := d.p.timing.latency
+	d.p.timingLock.Unlock()
+
+	// A period must be recorded completely before it can be processed.
+	period := time.Duration(d.period) * time.Second / time.Duration(d.rate)
+	silence := d.latency - source - sink - period
+	if silence < period {
+		silence = period
+	}
+	d.mu.Lock()
+	d.measured = source + period + silence + sink
+	d.mu.Unlock()
+
+	d.r.pullLock.Lock()
+	d.r.ring.discard(d.r.ring.len)
+	d.restart()
+	d.r.pullLock.Unlock()
+	if err := d.r.Start(); err != nil {
+		return err
+	}
+	return startPlayback([]*PlaybackStream{d.p}, silence)
+}
+
+func (d *Duplex) sourceLatency() (time.Duration, error) {
+	var rpl proto.GetRecordLatencyReply
+	err := d.c.request(&proto.GetRecordLatency{StreamIndex: d.r.index, Time: proto.NewTime(time.Now())}, &rpl)
+	if err != nil {
+		return 0, err
+	}
+	return rpl.Latency.Duration() + rpl.MonitorLatency.Duration(), nil
+}
+
+// Stop stops both streams.
+func (d *Duplex) Stop() error {
+	if err := d.r.Stop(); err != nil {
+		return err
+	}
+	// Wait for a period that is being sent, it is flushed by StopNow.
+	d.restart()
+	return d.p.StopNow()
+}
+
+// Close closes both streams.
+func (d *Duplex) Close() error {
+	err := d.r.Close()
+	if err2 := d.p.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Latency returns the time between recording a sample and playing it, as measured by the last call to Start.
+func (d *Duplex) Latency() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.measured
+}
+
+// Xruns returns the number of input overflows and output underflows since the duplex stream was created.
+func (d *Duplex) Xruns() (overflows, underflows int) {
+	return int(atomic.LoadInt64(&d.overflows)), int(atomic.LoadInt64(&d.underflows))
+}
+
+func (d *Duplex) xrun(x DuplexXrun) {
+	if x == InputOverflow {
+		atomic.AddInt64(&d.overflows, 1)
+	} else {
+		atomic.AddInt64(&d.underflows, 1)
+	}
+	if d.xrunChanges != nil {
+		select {
+		case d.xrunChanges <- x:
+		default:
+		}
+	}
+}
+
+// Record returns the record stream.
+func (d *Duplex) Record() *RecordStream { return d.r }
+
+// Playback returns the playback stream.
+func (d *Duplex) Playback() *PlaybackStream { return d.p }
+
+// Period returns the number of frames passed to the processing function at once.
+func (d *Duplex) Period() int { return d.period }
+
+// duplexObserver reports xruns to a Duplex and forwards all measurements to another observer.
+type duplexObserver struct {
+	StreamObserver
+	d     *Duplex
+	input bool // whether this is the observer of the record stream
+}
+
+func observer(o StreamObserver) StreamObserver {
+	if o == nil {
+		return NopStreamObserver{}
+	}
+	return o
+}
+
+func (o duplexObserver) Underflow(streamIndex uint32) {
+	o.d.xrun(OutputUnderflow)
+	o.StreamObserver.Underflow(streamIndex)
+}
+
+func (o duplexObserver) Overflow(streamIndex uint32) {
+	// Overflows of the playback stream can't happen, Duplex only writes what the server requested.
+	if o.input {
+		o.d.xrun(InputOverflow)
+	}
+	o.StreamObserver.Overflow(streamIndex)
+}
+
+// DuplexSampleRate sets the sample rate of both streams.
+func DuplexSampleRate(rate int) DuplexOption {
+	return func(d *Duplex) {
+		d.rate = rate
+	}
+}
+
+// DuplexChannels sets the channels of the record stream and the playback stream.
+func DuplexChannels(in, out proto.ChannelMap) DuplexOption {
+	return func(d *Duplex) {
+		d.inMap = in
+		d.outMap = out
+	}
+}
+
+// DuplexPeriod sets the number of frames that are processed at once. The default is 10ms.
+// It panics if frames is not positive.
+func DuplexPeriod(frames int) DuplexOption {
+	if frames <= 0 {
+		panic("pulse: invalid duplex period")
+	}
+	return func(d *Duplex) {
+		d.period = frames
+	}
+}
+
+// DuplexLatency sets the time between recording a sample and playing it in seconds. The default is 40ms.
+// If the latency of the sink and source is too high, the actual latency will be higher, see (*Duplex).Latency.
+func DuplexLatency(seconds float64) DuplexOption {
+	return func(d *Duplex) {
+		d.latency = time.Duration(seconds * float64(time.Second))
+	}
+}
+
+// DuplexXruns sets a channel that receives a value every time audio is lost.
+// Xruns are dropped if the channel is full.
+func DuplexXruns(xruns chan<- DuplexXrun) DuplexOption {
+	return func(d *Duplex) {
+		d.xrunChanges = xruns
+	}
+}
+
+// DuplexRecordOptions sets options for the record stream, e.g. RecordSource.
+// Options that change the sample spec or the buffer attributes should not be used.
+func DuplexRecordOptions(opts ...RecordOption) DuplexOption {
+	return func(d *Duplex) {
+		d.recordOpts = append(d.recordOpts, opts...)
+	}
+}
+
+// DuplexPlaybackOptions sets options for the playback stream, e.g. PlaybackSink.
+// Options that change the sample spec or the buffer attributes should not be used.
+func DuplexPlaybackOptions(opts ...PlaybackOption) DuplexOption {
+	return func(d *Duplex) {
+		d.playOpts = append(d.playOpts, opts...)
+	}
+}
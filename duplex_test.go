@@ -0,0 +1,156 @@
+package pulse
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// replyDuplexLatency answers latency requests with 5ms for both the source and the sink.
+func replyDuplexLatency(c *serverConn, op, tag uint32, args []interface{}) bool {
+	switch op {
+	case proto.OpGetRecordLatency:
+		requestTime := args[1].(proto.Time)
+		c.reply(tag, new(tags).usec(0).usec(5000).boolean(false).time(requestTime).time(requestTime).i64(0).i64(0))
+		return true
+	case proto.OpGetPlaybackLatency:
+		requestTime := args[1].(proto.Time)
+		c.reply(tag, new(tags).usec(5000).usec(0).boolean(false).time(requestTime).time(requestTime).
+			i64(0).i64(0).u64r(0).u64r(0))
+		return true
+	}
+	return false
+}
+
+func TestDuplex(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = replyDuplexLatency
+	c := s.client()
+	defer c.Close()
+
+	processed := make(chan []float32, 1)
+	xruns := make(chan DuplexXrun, 2)
+	d, err := c.NewDuplex(func(in, out [][]float32) {
+		for i := range in[0] {
+			out[0][i] = in[0][i] * 2
+			out[1][i] = -in[0][i]
+		}
+		processed <- append([]float32(nil), in[0]...)
+	}, DuplexSampleRate(8000), DuplexChannels(proto.ChannelMap{proto.ChannelMono}, proto.ChannelMap{proto.ChannelLeft, proto.ChannelRight}),
+		DuplexLatency(0.04), DuplexXruns(xruns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Period() != 80 {
+		t.Errorf("expected a period of 80 frames, got %d", d.Period())
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 40ms latency, 5ms each for the source and the sink, and one period for recording.
+	// The remaining 20ms are filled with silence.
+	if d.Latency() != 40*time.Millisecond {
+		t.Errorf("expected a latency of 40ms, got %v", d.Latency())
+	}
+	silence := 160 * 8
+	waitFor(t, func() bool { return s.dataReceived(d.Playback().StreamIndex()) == silence })
+
+	// Less than a period is not processed.
+	input := make([]float32, 80)
+	for i := range input {
+		input[i] = 0.25
+	}
+	s.conns[0].sendData(d.Record().StreamIndex(), float32Bytes(input[:40]))
+	s.conns[0].sendData(d.Record().StreamIndex(), float32Bytes(input[40:]))
+	if in := <-processed; len(in) != 80 || in[0] != 0.25 || in[79] != 0.25 {
+		t.Errorf("unexpected input %v", in)
+	}
+	waitFor(t, func() bool { return s.dataReceived(d.Playback().StreamIndex()) == silence+80*8 })
+
+	s.send(proto.OpUnderflow, new(tags).u32(d.Playback().StreamIndex()).i64(0))
+	// More than the read buffer holds.
+	s.conns[0].sendData(d.Record().StreamIndex(), make([]byte, 4*80*4+4))
+	if x := <-xruns; x != OutputUnderflow {
+		t.Errorf("expected an output underflow, got %v", x)
+	}
+	if x := <-xruns; x != InputOverflow {
+		t.Errorf("expected an input overflow, got %v", x)
+	}
+	if o, u := d.Xruns(); o != 1 || u != 1 {
+		t.Errorf("Xruns returned %d, %d", o, u)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDuplexRestart(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = func(c *serverConn, op, tag uint32, args []interface{}) bool {
+		if op == proto.OpFlushPlaybackStream {
+			// Like a real server, request the data that was flushed again.
+			c.reply(tag, new(tags))
+			c.send(proto.OpRequest, new(tags).u32(args[0].(uint32)).u32(2560))
+			return true
+		}
+		return replyDuplexLatency(c, op, tag, args)
+	}
+	c := s.client()
+	defer c.Close()
+
+	var processed int64
+	d, err := c.NewDuplex(func(in, out [][]float32) { atomic.AddInt64(&processed, 1) },
+		DuplexSampleRate(8000), DuplexChannels(proto.ChannelMap{proto.ChannelMono}, proto.ChannelMap{proto.ChannelLeft, proto.ChannelRight}),
+		DuplexLatency(0.04))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 20ms of silence and two periods fill the buffer, the third period has to wait.
+	silence := 160 * 8
+	for i := 0; i < 3; i++ {
+		s.conns[0].sendData(d.Record().StreamIndex(), make([]byte, 80*4))
+	}
+	waitFor(t, func() bool { return atomic.LoadInt64(&processed) == 3 })
+	waitFor(t, func() bool { return s.dataReceived(d.Playback().StreamIndex()) == silence+2*80*8 })
+
+	// The waiting period must not be played after the restart.
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	want := 2*silence + 2*80*8
+	waitFor(t, func() bool { return s.dataReceived(d.Playback().StreamIndex()) >= want })
+	time.Sleep(50 * time.Millisecond)
+	if n := s.dataReceived(d.Playback().StreamIndex()); n != want {
+		t.Errorf("expected %d bytes, got %d", want, n)
+	}
+}
+
+func TestDuplexInvalid(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	for name, f := range map[string]func(){
+		"nil process": func() { c.NewDuplex(nil) },
+		"zero period": func() { DuplexPeriod(0) },
+		"low rate":    func() { c.NewDuplex(func(in, out [][]float32) {}, DuplexSampleRate(50)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,204 @@
+package pulse
+
+import "github.com/jfreymuth/pulse/proto"
+
+// A StreamEventType identifies the kind of a StreamEvent.
+type StreamEventType int
+
+const (
+	// StreamMoved means that the stream was moved to a different sink or source,
+	// usually by the user through a volume control application.
+	StreamMoved StreamEventType = iota
+	// StreamSuspended means that the sink or source of the stream was suspended.
+	StreamSuspended
+	// StreamResumed means that the sink or source of the stream is no longer suspended.
+	StreamResumed
+	// StreamKilled means that the stream was removed by the server. The stream is closed.
+	StreamKilled
+	// StreamCorkRequested means that the server asks the application to pause the stream,
+	// e.g. because a phone call started. See PlaybackAutoCork.
+	StreamCorkRequested
+	// StreamUncorkRequested means that the stream may be resumed after a StreamCorkRequested event.
+	StreamUncorkRequested
+)
+
+func (t StreamEventType) String() string {
+	switch t {
+	case StreamMoved:
+		return "moved"
+	case StreamSuspended:
+		return "suspended"
+	case StreamResumed:
+		return "resumed"
+	case StreamKilled:
+		return "killed"
+	case StreamCorkRequested:
+		return "cork requested"
+	case StreamUncorkRequested:
+		return "uncork requested"
+	}
+	return "invalid"
+}
+
+// A StreamEvent notifies the application of a change to a stream that was not caused by the application itself.
+type StreamEvent struct {
+	Type StreamEventType
+	// DeviceIndex and DeviceName identify the sink or source the stream is connected to after the event.
+	// DeviceName is the same as the ID of a Sink or Source.
+	DeviceIndex uint32
+	DeviceName  string
+}
+
+// notify sends an event to the channel set with PlaybackEvents. Events are dropped if the channel is full.
+func (p *PlaybackStream) notify(t StreamEventType) {
+	index, name := p.SinkIndex(), p.SinkName()
+	p.eventsLock.Lock()
+	defer p.eventsLock.Unlock()
+	if p.streamEvents != nil {
+		select {
+		case p.streamEvents <- StreamEvent{Type: t, DeviceIndex: index, DeviceName: name}:
+		default:
+		}
+	}
+}
+
+func (p *PlaybackStream) moved(msg *proto.PlaybackStreamMoved) {
+	p.bufferLock.Lock()
+	p.createReply.SinkIndex = msg.DestIndex
+	p.createReply.SinkName = msg.DestName
+	p.createReply.SinkSuspended = msg.Suspended
+	p.bufferLock.Unlock()
+	if msg.BufferMaxLength != 0 {
+		p.bufferAttrChanged(PlaybackBufferAttr{
+			MaxLength:      msg.BufferMaxLength,
+			TargetLength:   msg.BufferTargetLength,
+			Prebuffer:      msg.BufferPrebufferLength,
+			MinimumRequest: msg.BufferMinimumRequest,
+		}, msg.SinkLatency)
+	}
+	p.notify(StreamMoved)
+}
+
+func (p *PlaybackStream) suspended(suspended bool) {
+	p.bufferLock.Lock()
+	p.createReply.SinkSuspended = suspended
+	p.bufferLock.Unlock()
+	if suspended {
+		p.notify(StreamSuspended)
+	} else {
+		p.notify(StreamResumed)
+	}
+}
+
+func (p *PlaybackStream) event(msg *proto.PlaybackStreamEvent) {
+	var cork bool
+	switch msg.Event {
+	case "request-cork":
+		cork = true
+		p.notify(StreamCorkRequested)
+	case "request-uncork":
+		p.notify(StreamUncorkRequested)
+	default:
+		return
+	}
+	if p.autoCork {
+		p.autoCorkLock.Lock()
+		p.corkRequested = cork
+		p.autoCorkLock.Unlock()
+		// Pausing sends a request, this must not block the client's read loop.
+		p.c.goroutine(p.applyAutoCork)
+	}
+}
+
+// applyAutoCork pauses or resumes the stream as requested by the server.
+// Only streams that were paused by applyAutoCork are resumed.
+func (p *PlaybackStream) applyAutoCork() {
+	p.autoCorkLock.Lock()
+	defer p.autoCorkLock.Unlock()
+	var err error
+	if p.corkRequested {
+		if p.state.is(running) {
+			err = p.Pause()
+			p.autoCorked = err == nil
+		}
+	} else if p.autoCorked {
+		p.autoCorked = false
+		if p.state.is(paused) {
+			err = p.Resume()
+		}
+	}
+	if err != nil && p.c.logger != nil && !p.Closed() {
+		p.c.logger.Log(proto.LevelWarn, "pulse: automatic cork failed", "index", p.index, "error", err)
+	}
+}
+
+// killed is called when the server removed the stream.
+func (p *PlaybackStream) killed() {
+	// The error is set first, so that it is visible as soon as the stream is closed.
+	p.err.set(ErrStreamKilled)
+	// The stream may be closed by Close at the same time.
+	if !p.state.setIfNot(killed, closed, serverLost, killed) {
+		return
+	}
+	p.c.mu.Lock()
+	delete(p.c.playback, p.index)
+	p.c.mu.Unlock()
+	if p.group != nil {
+		p.group.remove(p)
+	}
+	p.notify(StreamKilled)
+	p.release()
+}
+
+// notify sends an event to the channel set with RecordEvents. Events are dropped if the channel is full.
+func (r *RecordStream) notify(t StreamEventType) {
+	index, name := r.SourceIndex(), r.SourceName()
+	r.eventsLock.Lock()
+	defer r.eventsLock.Unlock()
+	if r.streamEvents != nil {
+		select {
+		case r.streamEvents <- StreamEvent{Type: t, DeviceIndex: index, DeviceName: name}:
+		default:
+		}
+	}
+}
+
+func (r *RecordStream) moved(msg *proto.RecordStreamMoved) {
+	r.bufferLock.Lock()
+	r.createReply.SourceIndex = msg.DestIndex
+	r.createReply.SourceName = msg.DestName
+	r.createReply.SourceSuspended = msg.Suspended
+	r.bufferLock.Unlock()
+	if msg.BufferMaxLength != 0 {
+		r.bufferAttrChanged(RecordBufferAttr{
+			MaxLength:    msg.BufferMaxLength,
+			FragmentSize: msg.BufferFragSize,
+		}, msg.SourceLatency)
+	}
+	r.notify(StreamMoved)
+}
+
+func (r *RecordStream) suspended(suspended bool) {
+	r.bufferLock.Lock()
+	r.createReply.SourceSuspended = suspended
+	r.bufferLock.Unlock()
+	if suspended {
+		r.notify(StreamSuspended)
+	} else {
+		r.notify(StreamResumed)
+	}
+}
+
+// killed is called when the server removed the stream.
+func (r *RecordStream) killed() {
+	r.err.set(ErrStreamKilled)
+	// The stream may be closed by Close at the same time.
+	if !r.state.setIfNot(killed, closed, serverLost, killed) {
+		return
+	}
+	r.c.mu.Lock()
+	delete(r.c.record, r.index)
+	r.c.mu.Unlock()
+	r.notify(StreamKilled)
+	r.release()
+}
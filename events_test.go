@@ -0,0 +1,164 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackEvents(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	events := make(chan StreamEvent, 4)
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SinkName() != "test-sink" {
+		t.Errorf("expected sink test-sink, got %q", p.SinkName())
+	}
+
+	s.send(proto.OpPlaybackStreamMoved, new(tags).u32(p.StreamIndex()).u32(3).str("hdmi").boolean(false).
+		u32(8000).u32(4000).u32(4000).u32(1000).usec(20000))
+	if ev := <-events; ev != (StreamEvent{Type: StreamMoved, DeviceIndex: 3, DeviceName: "hdmi"}) {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if p.SinkIndex() != 3 || p.SinkName() != "hdmi" || p.BufferSizeBytes() != 4000 {
+		t.Errorf("stream was not updated: sink %d %q, buffer size %d", p.SinkIndex(), p.SinkName(), p.BufferSizeBytes())
+	}
+
+	s.send(proto.OpPlaybackStreamSuspended, new(tags).u32(p.StreamIndex()).boolean(true))
+	if ev := <-events; ev.Type != StreamSuspended || !p.Suspended() {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	s.send(proto.OpPlaybackStreamSuspended, new(tags).u32(p.StreamIndex()).boolean(false))
+	if ev := <-events; ev.Type != StreamResumed || p.Suspended() {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	s.send(proto.OpPlaybackStreamKilled, new(tags).u32(p.StreamIndex()))
+	if ev := <-events; ev.Type != StreamKilled {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if _, ok := <-events; ok {
+		t.Error("events channel was not closed")
+	}
+	if !p.Closed() {
+		t.Error("killed stream is not closed")
+	}
+	if _, err := p.Write(make([]byte, 1<<20)); err != ErrStreamKilled {
+		t.Errorf("expected ErrStreamKilled, got %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordEvents(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	events := make(chan StreamEvent, 4)
+	r, err := c.NewPullRecord(proto.FormatUint8, RecordEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.send(proto.OpRecordStreamMoved, new(tags).u32(r.StreamIndex()).u32(5).str("mic").boolean(true).
+		u32(8000).u32(2000).usec(20000))
+	if ev := <-events; ev != (StreamEvent{Type: StreamMoved, DeviceIndex: 5, DeviceName: "mic"}) {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if r.SourceIndex() != 5 || r.SourceName() != "mic" || !r.Suspended() || r.BufferAttr().FragmentSize != 2000 {
+		t.Errorf("stream was not updated: source %d %q, buffer %+v", r.SourceIndex(), r.SourceName(), r.BufferAttr())
+	}
+
+	s.send(proto.OpRecordStreamKilled, new(tags).u32(r.StreamIndex()))
+	if ev := <-events; ev.Type != StreamKilled {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if _, err := r.Read(make([]byte, 16)); err != ErrStreamKilled {
+		t.Errorf("expected ErrStreamKilled, got %v", err)
+	}
+}
+
+func TestPlaybackAutoCork(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	events := make(chan StreamEvent, 4)
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackAutoCork, PlaybackEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.send(proto.OpPlaybackStreamEvent, new(tags).u32(p.StreamIndex()).str("request-cork").propList(proto.PropList{}))
+	if ev := <-events; ev.Type != StreamCorkRequested {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	waitFor(t, func() bool { return p.state.is(paused) })
+	s.send(proto.OpPlaybackStreamEvent, new(tags).u32(p.StreamIndex()).str("request-uncork").propList(proto.PropList{}))
+	if ev := <-events; ev.Type != StreamUncorkRequested {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	waitFor(t, func() bool { return p.Running() })
+	if n := s.received(proto.OpCorkPlaybackStream); n != 3 {
+		t.Errorf("expected 3 cork requests, got %d", n)
+	}
+
+	// A stream paused by the application stays paused.
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	s.send(proto.OpPlaybackStreamEvent, new(tags).u32(p.StreamIndex()).str("request-cork").propList(proto.PropList{}))
+	<-events
+	s.send(proto.OpPlaybackStreamEvent, new(tags).u32(p.StreamIndex()).str("request-uncork").propList(proto.PropList{}))
+	<-events
+	// Close waits for the goroutine that handles the events.
+	c.Close()
+	if n := s.received(proto.OpCorkPlaybackStream); n != 4 {
+		t.Errorf("expected 4 cork requests, got %d", n)
+	}
+}
+
+func TestKilledWhileClosing(t *testing.T) {
+	s := newTestServer(t)
+	// The server kills the streams while the delete requests are in flight.
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpDeletePlaybackStream:
+			c.send(proto.OpPlaybackStreamKilled, new(tags).u32(a[0].(uint32)))
+		case proto.OpDeleteRecordStream:
+			c.send(proto.OpRecordStreamKilled, new(tags).u32(a[0].(uint32)))
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	events := make(chan StreamEvent, 4)
+	p, err := c.NewPushPlayback(proto.FormatUint8, PlaybackEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewPullRecord(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-events; ok {
+		t.Error("a closed stream reported being killed")
+	}
+}
@@ -181,3 +181,27 @@ func float32Slice(s []byte) []float32 {
 	h := *(*reflect.SliceHeader)(unsafe.Pointer(&s))
 	return *(*[]float32)(unsafe.Pointer(&reflect.SliceHeader{Data: h.Data, Len: h.Len / 4, Cap: h.Len / 4}))
 }
+
+func int16Bytes(s []int16) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return sliceBytes(unsafe.Pointer(&s[0]), len(s)*2)
+}
+
+func float32Bytes(s []float32) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return sliceBytes(unsafe.Pointer(&s[0]), len(s)*4)
+}
+
+// sliceBytes returns a byte slice of length n that uses the memory at data.
+func sliceBytes(data unsafe.Pointer, n int) []byte {
+	var b []byte
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	h.Data = uintptr(data)
+	h.Len = n
+	h.Cap = n
+	return b
+}
@@ -0,0 +1,96 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackMoveTo(t *testing.T) {
+	s := newTestServer(t)
+	var noMove bool
+	sinks := map[uint32]uint32{} // sink input -> sink
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpCreatePlaybackStream:
+			noMove = a[16].(bool)
+		case proto.OpMoveSinkInput:
+			index, sink := a[0].(uint32), a[1].(uint32)
+			if noMove {
+				c.error(tag, proto.ErrNotSupported)
+				return true
+			}
+			sinks[index] = sink
+			// The server notifies the owner of the stream before it replies.
+			c.send(proto.OpPlaybackStreamMoved, new(tags).u32(index).u32(sink).str("hdmi").boolean(false).
+				u32(8000).u32(4000).u32(4000).u32(1000).usec(20000))
+			c.reply(tag, new(tags))
+			return true
+		case proto.OpGetSinkInputInfo:
+			index := a[0].(uint32)
+			c.reply(tag, sinkInputInfo(index, sinks[index], proto.ChannelVolumes{proto.VolumeNorm}, false))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	events := make(chan StreamEvent, 1)
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdmi := &Sink{info: proto.GetSinkInfoReply{SinkIndex: 7, SinkName: "hdmi"}}
+	if err := p.MoveTo(hdmi); err != nil {
+		t.Fatal(err)
+	}
+	if p.SinkIndex() != 7 || p.SinkName() != "hdmi" {
+		t.Errorf("expected sink 7 hdmi, got %d %q", p.SinkIndex(), p.SinkName())
+	}
+	if ev := <-events; ev.Type != StreamMoved || ev.DeviceIndex != 7 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	pinned, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackNoMove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pinned.MoveTo(hdmi); err == nil {
+		t.Error("expected an error")
+	}
+	if pinned.SinkName() != "test-sink" {
+		t.Errorf("expected sink test-sink, got %q", pinned.SinkName())
+	}
+}
+
+func TestRecordMoveTo(t *testing.T) {
+	s := newTestServer(t)
+	sources := map[uint32]uint32{} // source output -> source
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpMoveSourceOutput:
+			sources[a[0].(uint32)] = a[1].(uint32)
+			c.reply(tag, new(tags))
+			return true
+		case proto.OpGetSourceOutputInfo:
+			index := a[0].(uint32)
+			c.reply(tag, sourceOutputInfo(index, sources[index], proto.ChannelVolumes{proto.VolumeNorm}, false))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatInt16LE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.MoveTo(&Source{info: proto.GetSourceInfoReply{SourceIndex: 4, SourceName: "mic"}}); err != nil {
+		t.Fatal(err)
+	}
+	if r.SourceIndex() != 4 || r.SourceName() != "mic" {
+		t.Errorf("expected source 4 mic, got %d %q", r.SourceIndex(), r.SourceName())
+	}
+}
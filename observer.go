@@ -0,0 +1,22 @@
+package pulse
+
+import "time"
+
+// A StreamObserver receives measurements of a stream that can be used for metrics,
+// see PlaybackObserver and RecordObserver.
+// Measurements of the connection, like the amount of data sent, are reported by a proto.Observer, see ClientObserver.
+//
+// Methods may be called from the client's read goroutine, they should return quickly.
+// Embed NopStreamObserver to implement only some of the methods.
+type StreamObserver interface {
+	Underflow(streamIndex uint32)
+	Overflow(streamIndex uint32)
+	CallbackDone(streamIndex uint32, d time.Duration)
+}
+
+// NopStreamObserver implements StreamObserver, all methods do nothing.
+type NopStreamObserver struct{}
+
+func (NopStreamObserver) Underflow(streamIndex uint32)                     {}
+func (NopStreamObserver) Overflow(streamIndex uint32)                      {}
+func (NopStreamObserver) CallbackDone(streamIndex uint32, d time.Duration) {}
@@ -0,0 +1,40 @@
+package pulse
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+type testStreamObserver struct {
+	NopStreamObserver
+	underflows int32
+	overflows  int32
+}
+
+func (o *testStreamObserver) Underflow(streamIndex uint32) { atomic.AddInt32(&o.underflows, 1) }
+func (o *testStreamObserver) Overflow(streamIndex uint32)  { atomic.AddInt32(&o.overflows, 1) }
+
+func TestStreamObserver(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	o := &testStreamObserver{}
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackObserver(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewPullRecord(proto.FormatInt16LE, RecordObserver(o), RecordReadBufferSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.send(proto.OpUnderflow, new(tags).u32(p.StreamIndex()).i64(0))
+	s.send(proto.OpOverflow, new(tags).u32(p.StreamIndex()))
+	// The read buffer of the record stream overflows.
+	s.conns[0].sendData(r.StreamIndex(), make([]byte, 4))
+	waitFor(t, func() bool {
+		return atomic.LoadInt32(&o.underflows) == 1 && atomic.LoadInt32(&o.overflows) == 2
+	})
+}
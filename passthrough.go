@@ -0,0 +1,60 @@
+package pulse
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// NewPassthroughPlayback creates a playback stream for compressed audio that is passed through
+// to the sink without decoding, e.g. to an AV receiver connected via HDMI or S/PDIF.
+// The encoding must be one of the encoding constants defined in the proto package, other than EncodingPCM and EncodingAny.
+// rate is the sample rate of the encoded audio.
+//
+// The reader must provide the audio encapsulated in IEC 61937 frames.
+// The server fails to create the stream if the sink does not support the encoding, see (*Sink).SupportsEncoding.
+// Passthrough streams can not be mixed with other streams, and their volume can not be changed.
+//
+// The created stream wil not be running, it must be started with Start().
+func (c *Client) NewPassthroughPlayback(encoding byte, rate int, r io.Reader, opts ...PlaybackOption) (*PlaybackStream, error) {
+	if encoding == proto.EncodingPCM || encoding == proto.EncodingAny {
+		panic("pulse: invalid passthrough encoding")
+	}
+	passthrough := func(p *PlaybackStream) {
+		// IEC 61937 frames are transported like stereo 16 bit audio.
+		p.createRequest.ChannelMap = proto.ChannelMap{proto.ChannelLeft, proto.ChannelRight}
+		p.createRequest.Channels = 2
+		p.createRequest.Rate = uint32(rate)
+		p.createRequest.Passthrough = true
+		p.createRequest.Formats = []proto.FormatInfo{{
+			Encoding:   encoding,
+			Properties: proto.PropList{"format.rate": proto.PropListString(strconv.Itoa(rate))},
+		}}
+	}
+	p, err := c.newPlayback(proto.FormatInt16LE, NewReader(r, proto.FormatInt16LE), append([]PlaybackOption{passthrough}, opts...))
+	if err != nil {
+		return nil, err
+	}
+	if p.Encoding() != encoding {
+		p.Close()
+		return nil, ErrEncodingNotSupported
+	}
+	return p, nil
+}
+
+// Encoding returns the encoding of the stream, which is proto.EncodingPCM unless the stream was created with NewPassthroughPlayback.
+func (p *PlaybackStream) Encoding() byte {
+	return p.createReply.FormatInfo.Encoding
+}
+
+// SupportsEncoding returns wether the sink accepts audio in an encoding, see NewPassthroughPlayback.
+// The encoding must be one of the encoding constants defined in the proto package.
+func (s *Sink) SupportsEncoding(encoding byte) bool {
+	for _, f := range s.info.Formats {
+		if f.Encoding == encoding {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPassthroughPlayback(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpCreatePlaybackStream {
+			args = a
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	frames := &sliceReader{make([]byte, 6144)}
+	p, err := c.NewPassthroughPlayback(proto.EncodingAC3IEC61937, 48000, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[0] != (proto.SampleSpec{Format: proto.FormatInt16LE, Channels: 2, Rate: 48000}) || args[27] != true {
+		t.Errorf("unexpected request %v", args)
+	}
+	if f, ok := args[len(args)-1].(proto.FormatInfo); !ok || f.Encoding != proto.EncodingAC3IEC61937 {
+		t.Errorf("unexpected format %v", args[len(args)-1])
+	}
+	if p.Encoding() != proto.EncodingAC3IEC61937 {
+		t.Errorf("expected encoding %d, got %d", proto.EncodingAC3IEC61937, p.Encoding())
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 6144 })
+}
+
+func TestSinkSupportsEncoding(t *testing.T) {
+	sink := &Sink{info: proto.GetSinkInfoReply{Formats: []proto.FormatInfo{
+		{Encoding: proto.EncodingPCM},
+		{Encoding: proto.EncodingAC3IEC61937},
+	}}}
+	if !sink.SupportsEncoding(proto.EncodingAC3IEC61937) {
+		t.Error("AC3 should be supported")
+	}
+	if sink.SupportsEncoding(proto.EncodingDTSIEC61937) {
+		t.Error("DTS should not be supported")
+	}
+}
@@ -0,0 +1,100 @@
+package pulse
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// A PeakMeter measures the level of a source, a sink or a single playback stream, e.g. to display a level meter.
+// The server detects the peaks, so only one value per measurement is transferred;
+// this makes it possible to display meters for many streams at once.
+type PeakMeter struct {
+	r     *RecordStream
+	level uint32 // bits of the last level, accessed atomically
+
+	mu     sync.Mutex
+	levels chan<- float32 // protected by mu
+}
+
+// NewPeakMeter creates a peak meter that measures the default source.
+// Use RecordSource to measure a different source, or RecordMonitor to measure a sink.
+// rate is the number of measurements per second.
+//
+// Each measurement is the highest absolute sample value since the previous measurement, between 0 and 1.
+// Measurements are sent to levels and dropped if the channel is full, the channel is closed when the meter is closed.
+// levels may be nil, in which case the current level can be queried with Level.
+//
+// The created meter is not running, it must be started with Start().
+func (c *Client) NewPeakMeter(rate int, levels chan<- float32, opts ...RecordOption) (*PeakMeter, error) {
+	m := &PeakMeter{levels: levels}
+	peak := func(r *RecordStream) {
+		r.createRequest.ChannelMap = proto.ChannelMap{proto.ChannelMono}
+		r.createRequest.Channels = 1
+		r.createRequest.Rate = uint32(rate)
+		// Every fragment contains a single sample, the peak of the audio that was recorded since the last fragment.
+		r.createRequest.BufferFragSize = 4
+		r.createRequest.PeakDetect = true
+		r.createRequest.AdjustLatency = true
+		r.createRequest.DontInhibitAutoSuspend = true
+	}
+	r, err := c.NewRecord(Float32Writer(m.write), append([]RecordOption{peak}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	m.r = r
+	return m, nil
+}
+
+// NewSinkInputPeakMeter creates a peak meter that measures a single playback stream of any application,
+// identified by its sink input index. See NewPeakMeter.
+func (c *Client) NewSinkInputPeakMeter(sinkInput uint32, rate int, levels chan<- float32, opts ...RecordOption) (*PeakMeter, error) {
+	// The meter belongs to the sink input, it must not be moved to a different source.
+	return c.NewPeakMeter(rate, levels, append([]RecordOption{RecordSinkInput(sinkInput), RecordNoMove}, opts...)...)
+}
+
+func (m *PeakMeter) write(buf []float32) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, level := range buf {
+		if m.levels != nil {
+			select {
+			case m.levels <- level:
+			default:
+			}
+		}
+	}
+	atomic.StoreUint32(&m.level, math.Float32bits(buf[len(buf)-1]))
+	return len(buf), nil
+}
+
+// Level returns the most recent measurement.
+func (m *PeakMeter) Level() float32 {
+	return math.Float32frombits(atomic.LoadUint32(&m.level))
+}
+
+// Start starts measuring.
+func (m *PeakMeter) Start() error { return m.r.Start() }
+
+// Stop stops measuring.
+func (m *PeakMeter) Stop() error { return m.r.Stop() }
+
+// Close closes the meter and the levels channel.
+func (m *PeakMeter) Close() error {
+	err := m.r.Close()
+	m.mu.Lock()
+	if m.levels != nil {
+		close(m.levels)
+		m.levels = nil
+	}
+	m.mu.Unlock()
+	return err
+}
+
+// Stream returns the record stream used by the meter.
+func (m *PeakMeter) Stream() *RecordStream { return m.r }
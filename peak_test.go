@@ -0,0 +1,86 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPeakMeter(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpCreateRecordStream {
+			args = a
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	levels := make(chan float32, 4)
+	m, err := c.NewPeakMeter(25, levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec := args[0].(proto.SampleSpec); spec.Rate != 25 || spec.Channels != 1 || spec.Format != formatF32 {
+		t.Errorf("unexpected sample spec %+v", spec)
+	}
+	if args[6].(uint32) != 4 || !args[14].(bool) || !args[19].(bool) {
+		t.Errorf("fragment size %v, peak detect %v, don't inhibit auto suspend %v", args[6], args[14], args[19])
+	}
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.conns[0].sendData(m.Stream().StreamIndex(), float32Bytes([]float32{0.5, 0.25}))
+	if l := <-levels; l != 0.5 {
+		t.Errorf("expected 0.5, got %v", l)
+	}
+	if l := <-levels; l != 0.25 {
+		t.Errorf("expected 0.25, got %v", l)
+	}
+	if m.Level() != 0.25 {
+		t.Errorf("Level returned %v", m.Level())
+	}
+
+	if err := m.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-levels; ok {
+		t.Error("levels channel was not closed")
+	}
+}
+
+func TestSinkInputPeakMeter(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpGetSinkInputInfo:
+			c.reply(tag, sinkInputInfo(a[0].(uint32), 3, proto.ChannelVolumes{proto.VolumeNorm}, false))
+			return true
+		case proto.OpGetSinkInfo:
+			if a[0].(uint32) != 3 {
+				c.error(tag, proto.ErrNoSuchEntity)
+				return true
+			}
+			c.reply(tag, sinkInfo(3, 4))
+			return true
+		case proto.OpCreateRecordStream:
+			args = a
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	m, err := c.NewSinkInputPeakMeter(12, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if args[2].(uint32) != 4 || args[17].(uint32) != 12 || !args[12].(bool) {
+		t.Errorf("source %v, sink input %v, no move %v", args[2], args[17], args[12])
+	}
+}
@@ -1,30 +1,71 @@
 package pulse
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jfreymuth/pulse/proto"
 )
 
 // A PlaybackStream is used for playing audio.
-// When creating a stream, the user must provide a callback that will be used to buffer audio data.
+// When creating a stream, the user must either provide a callback that will be used to buffer audio data,
+// or create the stream with NewPushPlayback and write the data using Write.
 type PlaybackStream struct {
+	// 64-bit values accessed atomically come first, so that they are aligned on 32-bit platforms.
+	silence int64 // bytes of silence to play before reading, see StartAt
+
 	c *Client
 
-	index     uint32
-	state     *stateMachine
-	underflow bool
-	err       error
+	index      uint32
+	state      *stateMachine
+	underflows xrunCounter
+	overflows  xrunCounter
+	err        streamError
 
 	request chan int
 	started chan bool
+	done    chan struct{} // closed when the stream is closed
+
+	group *SyncGroup
+	queue *Queue // set for streams created with NewQueue
 
 	events        chan struct{}
-	eventsLock    sync.Mutex
+	eventsLock    sync.Mutex // protects events and streamEvents
 	volumeChanges chan proto.ChannelVolumes
+	muteChanges   chan bool
+	streamEvents  chan<- StreamEvent
+
+	autoCork      bool
+	autoCorkLock  sync.Mutex
+	corkRequested bool // protected by autoCorkLock
+	autoCorked    bool // protected by autoCorkLock
+
+	r        Reader
+	observer StreamObserver
+	onEnd    func(error)
+	playing  int32 // whether the server started playing since Start or the last underflow; accessed atomically
+
+	// push mode, used if r is nil
+	writeLock sync.Mutex // serializes calls to Write
+	pushLock  sync.Mutex
+	pushCond  *sync.Cond // signaled when writable changes or the stream is closed
+	writable  int        // protected by pushLock
+	partial   []byte     // incomplete frame from the last call to Write
 
-	r Reader
+	drainLock sync.Mutex
+	drainStop chan struct{} // closed to interrupt pending drains, protected by drainLock
+	ended     bool          // whether the reader ended and the remaining data is still playing, protected by drainLock
 
+	timingLock     sync.Mutex
+	timing         timingInfo    // protected by timingLock
+	lastTime       time.Duration // protected by timingLock
+	timingAuto     bool
+	timingInterval time.Duration
+
+	bufferLock     sync.Mutex // protects the buffer attributes and the sink in createReply, which can change at any time
 	createRequest  proto.CreatePlaybackStream
 	createReply    proto.CreatePlaybackStreamReply
 	bytesPerSample int
@@ -39,12 +80,27 @@ const EndOfData endOfData = false
 // can be used to intentionally stop the stream from within the callback.
 // The order of options is important in some cases, see the documentation of the individual PlaybackOptions.
 func (c *Client) NewPlayback(r Reader, opts ...PlaybackOption) (*PlaybackStream, error) {
+	return c.newPlayback(r.Format(), r, opts)
+}
+
+// NewPushPlayback creates a playback stream that is fed by calling Write
+// (or WriteFloat32, WriteInt16) instead of by a reader.
+// The format must be one of the constants defined in the proto package.
+//
+// Data can be written before the stream is started; it will be buffered by the server.
+// Start does not wait for the buffer to fill, the server starts playing as soon as enough data is written.
+func (c *Client) NewPushPlayback(format byte, opts ...PlaybackOption) (*PlaybackStream, error) {
+	check(format)
+	return c.newPlayback(format, nil, opts)
+}
+
+func (c *Client) newPlayback(format byte, r Reader, opts []PlaybackOption) (*PlaybackStream, error) {
 	p := &PlaybackStream{
 		c: c,
 		createRequest: proto.CreatePlaybackStream{
 			SinkIndex:             proto.Undefined,
 			ChannelMap:            proto.ChannelMap{proto.ChannelMono},
-			SampleSpec:            proto.SampleSpec{Format: r.Format(), Channels: 1, Rate: 44100},
+			SampleSpec:            proto.SampleSpec{Format: format, Channels: 1, Rate: 44100},
 			BufferMaxLength:       proto.Undefined,
 			Corked:                true,
 			BufferTargetLength:    proto.Undefined,
@@ -52,9 +108,15 @@ func (c *Client) NewPlayback(r Reader, opts ...PlaybackOption) (*PlaybackStream,
 			BufferMinimumRequest:  proto.Undefined,
 			Properties:            proto.PropList{},
 		},
-		bytesPerSample: bytes(r.Format()),
+		bytesPerSample: bytes(format),
 		r:              r,
 	}
+	p.state = newStateMachine(func(from, to streamState) {
+		c.logStateChange("playback", p.index, from, to)
+	})
+	p.pushCond = sync.NewCond(&p.pushLock)
+	// Streams with the same sync ID are linked by the server, so every stream needs its own ID.
+	p.createRequest.SyncID = c.newSyncID()
 
 	for _, opt := range opts {
 		opt(p)
@@ -70,50 +132,125 @@ func (c *Client) NewPlayback(r Reader, opts ...PlaybackOption) (*PlaybackStream,
 
 	// Listen for changes in the sink input if the application wants to be
 	// notified of volume changes.
-	if p.volumeChanges != nil {
+	if p.volumeChanges != nil || p.muteChanges != nil {
 		p.events = make(chan struct{}, 1)
-		go p.handleEvents(p.events)
 	}
 
-	err := c.c.Request(&p.createRequest, &p.createReply)
+	err := c.request(&p.createRequest, &p.createReply)
 	if err != nil {
+		if c.isClosed() {
+			// The connection was closed while the stream was being created.
+			return nil, ErrClientClosed
+		}
 		return nil, err
 	}
 	p.index = p.createReply.StreamIndex
-	p.state = newStateMachine()
 	p.request = make(chan int)
-	p.started = make(chan bool)
+	p.started = make(chan bool, 1)
+	p.done = make(chan struct{})
+	p.writable = int(p.createReply.Missing)
 	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		// The server removes the stream when the connection is closed.
+		return nil, ErrClientClosed
+	}
 	c.playback[p.index] = p
+	// Goroutines are started while holding the lock, so that Close waits for them.
+	if p.events != nil {
+		events := p.events
+		c.goroutine(func() { p.handleEvents(events) })
+	}
+	if r != nil {
+		c.goroutine(p.run)
+	}
+	if p.timingAuto {
+		c.goroutine(func() { p.updateTimingLoop(p.timingInterval) })
+	}
 	c.mu.Unlock()
-	go p.run()
+	if p.group != nil {
+		p.group.add(p)
+	}
 	return p, nil
 }
 
+// requestData is called when the server requests more data.
+func (p *PlaybackStream) requestData(n int) {
+	if p.r != nil {
+		p.request <- n
+		return
+	}
+	p.pushLock.Lock()
+	p.writable += n
+	p.pushLock.Unlock()
+	p.pushCond.Broadcast()
+}
+
+// wakeWriters unblocks calls to Write so that they check the state of the stream again.
+func (p *PlaybackStream) wakeWriters() {
+	p.pushLock.Lock()
+	p.pushLock.Unlock()
+	p.pushCond.Broadcast()
+}
+
 func (p *PlaybackStream) run() {
 	requested := 0
-	front := make([]byte, p.createReply.BufferMaxLength)
-	back := make([]byte, p.createReply.BufferMaxLength)
+	var front, back []byte
 
 	for bufferLength := range p.request {
 		if !p.state.is(running) {
 			continue
 		}
+		// The buffer size can be changed by the server.
+		if size := int(p.BufferAttr().MaxLength); size > len(front) {
+			front = make([]byte, size)
+			back = make([]byte, size)
+		}
 		requested += bufferLength
-		for requested > 0 {
-			readCount, err := p.r.Read(front[:requested])
-			if err != nil {
-				if err != EndOfData {
-					p.err = err
+		// Stop reading as soon as the stream is stopped, data read afterwards would be played after a restart.
+		for requested > 0 && p.state.is(running) {
+			n := requested
+			if n > len(front) {
+				n = len(front)
+			}
+			var readCount int
+			var err error
+			if silence := atomic.LoadInt64(&p.silence); silence > 0 {
+				if int64(n) > silence {
+					n = int(silence)
 				}
-				p.state.set(idle)
-				break
+				p.fillSilence(front[:n])
+				atomic.AddInt64(&p.silence, -int64(n))
+				readCount = n
+			} else {
+				readCount, err = p.read(front[:n])
 			}
 			if readCount > 0 {
 				p.c.c.Send(p.index, front[:readCount])
 				requested -= readCount
 				front, back = back, front
 			}
+			if err != nil {
+				if err == EndOfData {
+					err = nil
+				} else {
+					p.err.set(err)
+				}
+				// Get the channel before the state changes, see DrainContext.
+				stop := p.readerEnded()
+				p.state.setIf(idle, running)
+				requested = 0
+				if p.onEnd != nil || p.needsTrigger() {
+					// This must not block, the client's read loop may be waiting for this goroutine.
+					p.c.goroutine(func() { p.end(err, stop) })
+				}
+				// Don't let Start wait for the remaining data.
+				select {
+				case p.started <- true:
+				default:
+				}
+				break
+			}
 
 			select {
 			case nextBufferLength := <-p.request:
@@ -121,19 +258,53 @@ func (p *PlaybackStream) run() {
 			default:
 			}
 		}
+		if !p.state.is(running) {
+			requested = 0
+		}
 	}
 }
 
+// end is called when the reader has no more data. err is the reader's error, or nil for EndOfData.
+func (p *PlaybackStream) end(err error, stop <-chan struct{}) {
+	if p.needsTrigger() {
+		p.Trigger()
+	}
+	if p.onEnd == nil {
+		return
+	}
+	if drainErr := p.drain(context.Background(), stop); err == nil {
+		err = drainErr
+	}
+	p.onEnd(err)
+}
+
+// needsTrigger returns true if the server waits for the prebuffer to fill before it starts playing.
+// If the reader ended before that, the remaining data must be triggered.
+func (p *PlaybackStream) needsTrigger() bool {
+	return p.BufferAttr().Prebuffer > 0 && atomic.LoadInt32(&p.playing) == 0
+}
+
+func (p *PlaybackStream) read(buf []byte) (int, error) {
+	if p.observer == nil {
+		return p.r.Read(buf)
+	}
+	start := time.Now()
+	n, err := p.r.Read(buf)
+	p.observer.CallbackDone(p.index, time.Since(start))
+	return n, err
+}
+
 // Handle events for this playback stream in a goroutine.
 // Event notifications are received through the events channel.
 func (p *PlaybackStream) handleEvents(events chan struct{}) {
 	volume := make(proto.ChannelVolumes, len(p.createRequest.ChannelMap))
+	muted := p.createRequest.MutedSet && p.createRequest.Muted
 
 	for range events {
 		// We got an event that something about our sink input changed, so read
 		// the sink input information.
 		reply := proto.GetSinkInputInfoReply{}
-		err := p.c.c.Request(&proto.GetSinkInputInfo{
+		err := p.c.request(&proto.GetSinkInputInfo{
 			SinkInputIndex: p.createReply.SinkInputIndex,
 		}, &reply)
 		if err != nil {
@@ -143,7 +314,10 @@ func (p *PlaybackStream) handleEvents(events chan struct{}) {
 				break
 			}
 			// This should not normally happen.
-			panic(err)
+			if p.c.logger != nil {
+				p.c.logger.Log(proto.LevelWarn, "pulse: could not query sink input", "index", p.createReply.SinkInputIndex, "error", err)
+			}
+			continue
 		}
 
 		// Check whether the volume changed, and if so, report it to the
@@ -155,87 +329,477 @@ func (p *PlaybackStream) handleEvents(events chan struct{}) {
 				volumeChanged = true
 			}
 		}
-		if volumeChanged {
-			volumeToSend := append(proto.ChannelVolumes(nil), volume...) // copy volume
-
-			// Drop last volume change, if not received by the application.
-			// This way, if p.volumeChanges is a buffered channel, some updates
-			// might get lost when the receiver is slow but it will always
-			// receive the latest volume eventually.
-			select {
-			case <-p.volumeChanges:
-				// Dropped, so there was something in the buffered channel.
-			default:
-				// Not dropped, so if the channel is buffered, it should have
-				// room now.
-			}
-
-			// Send the new volume.
-			select {
-			case p.volumeChanges <- volumeToSend:
-				// Succeeded in sending!
-			default:
-				// Somehow couldn't send the new volume value. Perhaps the
-				// channel is unbuffered, and the receiving goroutine is doing
-				// other things? There's not much we can do about it here.
+		if volumeChanged && p.volumeChanges != nil {
+			sendVolume(p.volumeChanges, append(proto.ChannelVolumes(nil), volume...)) // copy volume
+		}
+		if reply.Muted != muted {
+			muted = reply.Muted
+			if p.muteChanges != nil {
+				sendMute(p.muteChanges, muted)
 			}
 		}
 	}
 
-	// Playback stream was closed, so close the volume changes channel.
-	close(p.volumeChanges)
+	// Playback stream was closed, so close the channels.
+	if p.volumeChanges != nil {
+		close(p.volumeChanges)
+	}
+	if p.muteChanges != nil {
+		close(p.muteChanges)
+	}
 }
 
 // Start starts playing audio.
-func (p *PlaybackStream) Start() {
-	if p.state.is(idle) {
-		p.c.c.Request(&proto.FlushPlaybackStream{StreamIndex: p.index}, nil)
-		p.state.set(running)
-		p.err = nil
-		p.request <- int(p.createReply.BufferTargetLength)
-		p.underflow = false
-		p.c.c.Request(&proto.CorkPlaybackStream{StreamIndex: p.index, Corked: false}, nil)
-		<-p.started
+// If the stream belongs to a SyncGroup, all streams in the group are started.
+func (p *PlaybackStream) Start() error {
+	if p.group != nil {
+		return p.group.Start()
 	}
+	return startPlayback([]*PlaybackStream{p}, 0)
 }
 
 // Stop stops playing audio; the callback will no longer be called.
-// If the buffer size/latency is large, audio may continue to play for some time after the call to Stop.
+// If the buffer size/latency is large, audio may continue to play for some time after the call to Stop,
+// use StopNow to stop immediately.
 func (p *PlaybackStream) Stop() {
-	if p.state.is(running, paused) {
-		p.state.set(idle)
+	p.state.ops.Lock()
+	defer p.state.ops.Unlock()
+	p.state.setIf(idle, running, paused)
+	// The stream may be idle because its reader ended, its remaining data is no longer drained.
+	p.interruptDrain()
+}
+
+// StopNow stops playing audio immediately and discards the audio buffered on the server.
+// Unlike Pause, the stream is stopped and can be restarted with Start.
+// If the stream belongs to a SyncGroup, all streams in the group are stopped.
+func (p *PlaybackStream) StopNow() error {
+	if p.group != nil {
+		return p.group.StopNow()
 	}
+	return stopPlayback([]*PlaybackStream{p})
+}
+
+// stopPlayback corks and flushes all streams in ps.
+// The streams must either be a single stream or the streams of a SyncGroup.
+func stopPlayback(ps []*PlaybackStream) error {
+	defer lockOps(ps)()
+	var stopping []*PlaybackStream
+	for _, p := range ps {
+		// Idle streams may still be playing the data written before the reader ended.
+		if p.state.is(idle, running, paused) {
+			stopping = append(stopping, p)
+		}
+	}
+	if len(stopping) == 0 {
+		return nil
+	}
+	p := stopping[0]
+	err := p.c.request(&proto.CorkPlaybackStream{StreamIndex: p.index, Corked: true}, nil)
+	if err != nil {
+		return err
+	}
+	// The streams are stopped once they are corked, even if flushing fails.
+	for _, p := range stopping {
+		p.state.setIfNot(idle, closed, serverLost, killed)
+		p.interruptDrain()
+	}
+	for _, p := range stopping {
+		err := p.c.request(&proto.FlushPlaybackStream{StreamIndex: p.index}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Pause stops playing audio immediately.
-func (p *PlaybackStream) Pause() {
-	if p.state.is(running) {
-		p.c.c.Request(&proto.CorkPlaybackStream{StreamIndex: p.index, Corked: true}, nil)
-		p.state.set(paused)
+// If the stream belongs to a SyncGroup, all streams in the group are paused.
+func (p *PlaybackStream) Pause() error {
+	if p.group != nil {
+		return p.group.Pause()
 	}
+	return corkPlayback([]*PlaybackStream{p}, true)
 }
 
 // Resume resumes a paused stream.
-func (p *PlaybackStream) Resume() {
+// If the stream belongs to a SyncGroup, all streams in the group are resumed.
+func (p *PlaybackStream) Resume() error {
+	if p.group != nil {
+		return p.group.Resume()
+	}
+	return corkPlayback([]*PlaybackStream{p}, false)
+}
+
+// Trigger starts playback immediately, even if the server has not yet received enough data to fill the prebuffer.
+// See PlaybackPrebuffer.
+func (p *PlaybackStream) Trigger() error {
+	return p.c.request(&proto.TriggerPlaybackStream{StreamIndex: p.index}, nil)
+}
+
+// Prebuffer pauses playback until the server has received enough data to fill the prebuffer.
+// See PlaybackPrebuffer.
+func (p *PlaybackStream) Prebuffer() error {
+	return p.c.request(&proto.PrebufPlaybackStream{StreamIndex: p.index}, nil)
+}
+
+// startPlayback starts all idle streams in ps, after playing the given duration of silence.
+// The streams must either be a single stream or the streams of a SyncGroup,
+// because the server is only asked to uncork one of them.
+func startPlayback(ps []*PlaybackStream, silence time.Duration) error {
+	unlock := lockOps(ps)
+	starting, err := uncorkPlayback(ps, silence)
+	// Stop and Close must not wait until the server starts playing.
+	unlock()
+	if err != nil {
+		return err
+	}
+	for _, p := range starting {
+		if p.r != nil {
+			select {
+			case <-p.started:
+			case <-p.done:
+			}
+		}
+	}
+	return nil
+}
+
+// uncorkPlayback starts the idle streams in ps for startPlayback and returns the streams that were started.
+func uncorkPlayback(ps []*PlaybackStream, silence time.Duration) ([]*PlaybackStream, error) {
+	var starting []*PlaybackStream
+	for _, p := range ps {
+		if !p.state.is(idle) {
+			continue
+		}
+		if p.r != nil {
+			p.interruptDrain()
+			if err := p.prepareStart(); err != nil {
+				return nil, err
+			}
+			// Discard a notification left over from an earlier start.
+			select {
+			case <-p.started:
+			default:
+			}
+		}
+		// The stream may have been closed in the meantime.
+		if !p.state.setIf(running, idle) {
+			continue
+		}
+		p.err.set(nil)
+		p.underflows.reset()
+		p.overflows.reset()
+		atomic.StoreInt32(&p.playing, 0)
+		if p.r != nil {
+			atomic.StoreInt64(&p.silence, int64(p.durationToBytes(silence)))
+			p.request <- int(p.BufferAttr().TargetLength)
+		} else if silence > 0 {
+			if err := p.writeSilence(int(p.durationToBytes(silence))); err != nil {
+				return nil, err
+			}
+		}
+		starting = append(starting, p)
+	}
+	if len(starting) == 0 {
+		return nil, nil
+	}
+	p := starting[0]
+	err := p.c.request(&proto.CorkPlaybackStream{StreamIndex: p.index, Corked: false}, nil)
+	if err != nil {
+		for _, p := range starting {
+			p.state.setIf(idle, running)
+		}
+		return nil, err
+	}
+	return starting, nil
+}
+
+// lockOps locks the streams in ps for a Start, Stop, Pause or Resume and returns a function that unlocks them.
+// The streams of a SyncGroup are always locked in the same order.
+func lockOps(ps []*PlaybackStream) (unlock func()) {
+	for _, p := range ps {
+		p.state.ops.Lock()
+	}
+	return func() {
+		for _, p := range ps {
+			p.state.ops.Unlock()
+		}
+	}
+}
+
+// prepareStart discards the data buffered on the server before a stream with a reader is started,
+// so that data read before the stream was stopped is not played. Queues may keep the data, see (*Queue).prepareStart.
+func (p *PlaybackStream) prepareStart() error {
+	if p.queue != nil {
+		return p.queue.prepareStart()
+	}
+	return p.c.request(&proto.FlushPlaybackStream{StreamIndex: p.index}, nil)
+}
+
+// corkPlayback pauses all running streams in ps or resumes all paused streams.
+// The streams must either be a single stream or the streams of a SyncGroup.
+func corkPlayback(ps []*PlaybackStream, cork bool) error {
+	defer lockOps(ps)()
+	from, to := paused, running
+	if cork {
+		from, to = running, paused
+	}
+	var changing []*PlaybackStream
+	for _, p := range ps {
+		if p.state.is(from) {
+			changing = append(changing, p)
+		}
+	}
+	if len(changing) == 0 {
+		return nil
+	}
+	p := changing[0]
+	err := p.c.request(&proto.CorkPlaybackStream{StreamIndex: p.index, Corked: cork}, nil)
+	if err != nil {
+		return err
+	}
+	for _, p := range changing {
+		if !p.state.setIf(to, from) {
+			continue
+		}
+		if cork {
+			p.interruptDrain()
+		} else {
+			p.underflows.resume()
+			p.overflows.resume()
+		}
+	}
+	return nil
+}
+
+// Drain waits until the playback has ended, see DrainContext.
+func (p *PlaybackStream) Drain() error {
+	return p.DrainContext(context.Background())
+}
+
+// DrainContext waits until all data written to the stream has been played.
+// Unlike other requests, draining is not limited by the client's timeout, since it can take as long as
+// the server-side buffer is. Instead, DrainContext returns ctx.Err() if ctx is done first.
+//
+// DrainContext returns nil if the stream is not running, unless its reader ended and the stream was not stopped since;
+// then it waits until the remaining data has been played.
+// It returns ErrDrainInterrupted if the stream is paused, or if it is paused, stopped, flushed or closed
+// before the drain has finished.
+func (p *PlaybackStream) DrainContext(ctx context.Context) error {
+	// Get the channel first, the stream's state changes before the channel is closed.
+	stop, ended := p.drainState()
 	if p.state.is(paused) {
-		p.c.c.Request(&proto.CorkPlaybackStream{StreamIndex: p.index, Corked: false}, nil)
-		p.state.set(running)
-		p.underflow = false
+		return ErrDrainInterrupted
+	}
+	if !p.state.is(running) && !ended {
+		return nil
 	}
+	return p.drain(ctx, stop)
 }
 
-// Drain waits until the playback has ended.
-// Drain does not return when the stream is paused.
-func (p *PlaybackStream) Drain() {
-	if p.state.is(running) {
-		p.c.c.Request(&proto.DrainPlaybackStream{StreamIndex: p.index}, nil)
+func (p *PlaybackStream) drain(ctx context.Context, stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	err := p.c.requestContext(ctx, &proto.DrainPlaybackStream{StreamIndex: p.index}, nil)
+	select {
+	case <-stop:
+		return ErrDrainInterrupted
+	default:
 	}
+	if errors.Is(err, proto.ErrNoSuchEntity) {
+		// The server aborts the drain with this error if the stream is flushed.
+		return ErrDrainInterrupted
+	}
+	return err
+}
+
+// DrainAsync starts draining the stream and returns a channel that receives the result of DrainContext.
+func (p *PlaybackStream) DrainAsync() <-chan error {
+	result := make(chan error, 1)
+	p.c.goroutine(func() { result <- p.Drain() })
+	return result
+}
+
+// drainState returns the channel that is closed when pending drains are interrupted,
+// and whether the reader ended and the remaining data is still playing.
+func (p *PlaybackStream) drainState() (<-chan struct{}, bool) {
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+	if p.drainStop == nil {
+		p.drainStop = make(chan struct{})
+	}
+	return p.drainStop, p.ended
+}
+
+// readerEnded is called by run when the reader ended. It returns the same channel as drainState.
+func (p *PlaybackStream) readerEnded() <-chan struct{} {
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+	if p.drainStop == nil {
+		p.drainStop = make(chan struct{})
+	}
+	p.ended = true
+	return p.drainStop
+}
+
+// interruptDrain makes pending calls to Drain return ErrDrainInterrupted.
+// Data left over from a reader that ended is no longer drained.
+func (p *PlaybackStream) interruptDrain() {
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+	p.ended = false
+	if p.drainStop != nil {
+		close(p.drainStop)
+		p.drainStop = nil
+	}
+}
+
+// Write writes audio data to a stream created with NewPushPlayback.
+// The data must be in the stream's sample format.
+// Write blocks until the server has requested enough data to accept all of buf.
+// Incomplete frames are kept until the next call to Write.
+// If an error occurs, Write returns the number of bytes that were sent or kept before the error.
+//
+// Together with Start and Drain, this allows using a PlaybackStream as an io.Writer, e.g. with io.Copy.
+func (p *PlaybackStream) Write(buf []byte) (int, error) {
+	if p.r != nil {
+		return 0, ErrPullStream
+	}
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	frame := p.bytesPerSample * int(p.createReply.Channels)
+	n := 0
+	if len(p.partial) > 0 {
+		n = frame - len(p.partial)
+		if n > len(buf) {
+			p.partial = append(p.partial, buf...)
+			return len(buf), nil
+		}
+		// The completed frame is kept if it can not be sent, so these bytes count as written.
+		p.partial = append(p.partial, buf[:n]...)
+		if _, err := p.writeFrames(p.partial); err != nil {
+			return n, err
+		}
+		p.partial = p.partial[:0]
+	}
+	rest := (len(buf) - n) % frame
+	m, err := p.writeFrames(buf[n : len(buf)-rest])
+	if err != nil {
+		return n + m, err
+	}
+	p.partial = append(p.partial, buf[len(buf)-rest:]...)
+	return len(buf), nil
+}
+
+// writeFrames sends buf, which must contain whole frames, and returns the number of bytes sent.
+func (p *PlaybackStream) writeFrames(buf []byte) (int, error) {
+	frame := p.bytesPerSample * int(p.createReply.Channels)
+	sent := 0
+	for len(buf) > 0 {
+		p.pushLock.Lock()
+		for p.writable < frame && !p.Closed() {
+			p.pushCond.Wait()
+		}
+		if p.Closed() {
+			p.pushLock.Unlock()
+			if err := p.err.get(); err != nil {
+				return sent, err
+			}
+			return sent, ErrStreamClosed
+		}
+		n := p.writable
+		if n > len(buf) {
+			n = len(buf)
+		}
+		n -= n % frame
+		p.writable -= n
+		p.pushLock.Unlock()
+
+		if err := p.c.c.Send(p.index, buf[:n]); err != nil {
+			return sent, err
+		}
+		buf = buf[n:]
+		sent += n
+	}
+	return sent, nil
+}
+
+// writeSilence sends up to n bytes of silence, limited to the amount of data the server has requested.
+func (p *PlaybackStream) writeSilence(n int) error {
+	p.pushLock.Lock()
+	if n > p.writable {
+		n = p.writable
+	}
+	n -= n % (p.bytesPerSample * int(p.createReply.Channels))
+	if n > 0 {
+		p.writable -= n
+	}
+	p.pushLock.Unlock()
+	if n <= 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	p.fillSilence(buf)
+	return p.c.c.Send(p.index, buf)
+}
+
+// fillSilence fills buf with silence in the stream's format.
+func (p *PlaybackStream) fillSilence(buf []byte) {
+	var zero byte
+	if p.createRequest.Format == proto.FormatUint8 {
+		zero = 0x80
+	}
+	for i := range buf {
+		buf[i] = zero
+	}
+}
+
+// WriteFloat32 is like Write, but accepts float32 samples.
+// It returns the number of samples written. The stream must use the native float32 format.
+func (p *PlaybackStream) WriteFloat32(buf []float32) (int, error) {
+	if p.createRequest.Format != formatF32 {
+		return 0, ErrWrongFormat
+	}
+	n, err := p.Write(float32Bytes(buf))
+	return n / 4, err
+}
+
+// WriteInt16 is like Write, but accepts int16 samples.
+// It returns the number of samples written. The stream must use the native int16 format.
+func (p *PlaybackStream) WriteInt16(buf []int16) (int, error) {
+	if p.createRequest.Format != formatI16 {
+		return 0, ErrWrongFormat
+	}
+	n, err := p.Write(int16Bytes(buf))
+	return n / 2, err
+}
+
+// Writable returns the number of bytes that can currently be written without blocking.
+// It always returns 0 for streams that are not created with NewPushPlayback.
+func (p *PlaybackStream) Writable() int {
+	if p.r != nil {
+		return 0
+	}
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	return p.writable
 }
 
 // Volume returns the volume of each channel in the playback.
 func (p *PlaybackStream) Volume() (proto.ChannelVolumes, error) {
 	reply := proto.GetSinkInputInfoReply{}
-	err := p.c.c.Request(&proto.GetSinkInputInfo{
+	err := p.c.request(&proto.GetSinkInputInfo{
 		SinkInputIndex: p.createReply.SinkInputIndex,
 	}, &reply)
 	if err != nil {
@@ -259,49 +823,140 @@ func (p *PlaybackStream) Volume() (proto.ChannelVolumes, error) {
 // the volume slider in the application synchronized with the system volume
 // mixer.
 func (p *PlaybackStream) SetVolume(volumes proto.ChannelVolumes) error {
-	return p.c.c.Request(&proto.SetSinkInputVolume{
+	return p.c.request(&proto.SetSinkInputVolume{
 		SinkInputIndex: p.createReply.SinkInputIndex,
 		ChannelVolumes: volumes,
 	}, nil)
 }
 
+// Mute returns wether the playback is muted.
+func (p *PlaybackStream) Mute() (bool, error) {
+	reply := proto.GetSinkInputInfoReply{}
+	err := p.c.request(&proto.GetSinkInputInfo{
+		SinkInputIndex: p.createReply.SinkInputIndex,
+	}, &reply)
+	if err != nil {
+		return false, err
+	}
+	return reply.Muted, nil
+}
+
+// SetMute mutes or unmutes the playback.
+// Like the volume, this should only be changed as a direct result of user input, see SetVolume.
+func (p *PlaybackStream) SetMute(mute bool) error {
+	return p.c.request(&proto.SetSinkInputMute{
+		SinkInputIndex: p.createReply.SinkInputIndex,
+		Mute:           mute,
+	}, nil)
+}
+
+// MoveTo moves the stream to a different sink while it is playing.
+// The server fails to move streams that were created with PlaybackNoMove.
+// Like moves by other clients, this is also reported as a StreamMoved event.
+func (p *PlaybackStream) MoveTo(sink *Sink) error {
+	err := p.c.request(&proto.MoveSinkInput{
+		SinkInputIndex: p.createReply.SinkInputIndex,
+		DeviceIndex:    sink.info.SinkIndex,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	reply := proto.GetSinkInputInfoReply{}
+	err = p.c.request(&proto.GetSinkInputInfo{
+		SinkInputIndex: p.createReply.SinkInputIndex,
+	}, &reply)
+	if err != nil {
+		return err
+	}
+	p.bufferLock.Lock()
+	p.createReply.SinkIndex = reply.SinkIndex
+	p.createReply.SinkName = sink.info.SinkName
+	p.createReply.SinkLatency = reply.SinkLatency
+	p.bufferLock.Unlock()
+	atomic.StoreUint32(&p.createReply.Rate, reply.Rate)
+	return nil
+}
+
 // Close closes the stream.
-func (p *PlaybackStream) Close() {
-	if !p.Closed() {
-		p.c.c.Request(&proto.DeletePlaybackStream{StreamIndex: p.index}, nil)
-		p.state.set(closed)
-		close(p.request)
-
-		p.c.mu.Lock()
-		delete(p.c.playback, p.index)
-		p.c.mu.Unlock()
-
-		p.eventsLock.Lock()
-		if p.events != nil {
-			close(p.events)
-			p.events = nil
-		}
-		p.eventsLock.Unlock()
+// The stream is closed even if the server returns an error.
+func (p *PlaybackStream) Close() error {
+	// The stream may be killed by the server or lose the connection while the request is sent.
+	// Only the first of these releases the stream.
+	if !p.state.setIfNot(closed, closed, serverLost, killed) {
+		return nil
+	}
+	err := p.c.deleteStream(&proto.DeletePlaybackStream{StreamIndex: p.index})
+
+	p.c.mu.Lock()
+	delete(p.c.playback, p.index)
+	p.c.mu.Unlock()
+	if p.group != nil {
+		p.group.remove(p)
+	}
+
+	p.release()
+	return err
+}
+
+// release stops the stream's goroutines and unblocks waiting calls after the stream was closed.
+// It must only be called by the caller that changed the state to closed, serverLost or killed.
+func (p *PlaybackStream) release() {
+	close(p.request)
+	close(p.done)
+	p.wakeWriters()
+	p.interruptDrain()
+
+	p.eventsLock.Lock()
+	if p.events != nil {
+		close(p.events)
+		p.events = nil
+	}
+	if p.streamEvents != nil {
+		close(p.streamEvents)
+		p.streamEvents = nil
 	}
+	p.eventsLock.Unlock()
+	p.underflows.close()
+	p.overflows.close()
 }
 
 // Closed returns wether the stream was closed.
-func (p *PlaybackStream) Closed() bool { return p.state.is(closed, serverLost) }
+// This includes streams that were closed by the server, see StreamKilled.
+func (p *PlaybackStream) Closed() bool { return p.state.is(closed, serverLost, killed) }
 
 // Running returns wether the stream is currently playing.
 func (p *PlaybackStream) Running() bool { return p.state.is(running) }
 
 // Underflow returns true if any underflows happend since the last call to Start or Resume.
 // Underflows usually happen because the latency/buffer size is too low or because the callback
-// takes too long to run.
-func (p *PlaybackStream) Underflow() bool { return p.underflow }
+// takes too long to run. See also Underflows.
+func (p *PlaybackStream) Underflow() bool { return p.underflows.happened() }
 
 // Error returns the last error returned by the stream's reader.
-func (p *PlaybackStream) Error() error { return p.err }
+func (p *PlaybackStream) Error() error { return p.err.get() }
 
 // SampleRate returns the stream's sample rate (samples per second).
 func (p *PlaybackStream) SampleRate() int {
-	return int(p.createReply.Rate)
+	return int(p.rate())
+}
+
+// SetSampleRate changes the sample rate of a stream that is already running.
+// The stream must be created with the PlaybackVariableRate option.
+//
+// This can be used to compensate for clock drift between the source of the audio and the sink,
+// see DriftController.
+func (p *PlaybackStream) SetSampleRate(rate int) error {
+	err := p.c.request(&proto.UpdatePlaybackStreamSampleRate{StreamIndex: p.index, SampleRate: uint32(rate)}, nil)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32(&p.createReply.Rate, uint32(rate))
+	return nil
+}
+
+// rate returns the current sample rate, which can be changed by SetSampleRate.
+func (p *PlaybackStream) rate() uint32 {
+	return atomic.LoadUint32(&p.createReply.Rate)
 }
 
 // Channels returns the number of channels.
@@ -311,13 +966,13 @@ func (p *PlaybackStream) Channels() int {
 
 // BufferSize returns the size of the server-side buffer in samples.
 func (p *PlaybackStream) BufferSize() int {
-	s := int(p.createReply.BufferTargetLength) / int(p.createReply.Channels)
+	s := p.BufferSizeBytes() / int(p.createReply.Channels)
 	return s / p.bytesPerSample
 }
 
 // BufferSizeBytes returns the size of the server-side buffer in bytes.
 func (p *PlaybackStream) BufferSizeBytes() int {
-	return int(p.createReply.BufferTargetLength)
+	return int(p.BufferAttr().TargetLength)
 }
 
 // StreamIndex returns the stream index.
@@ -330,6 +985,29 @@ func (p *PlaybackStream) StreamInputIndex() uint32 {
 	return p.createReply.SinkInputIndex
 }
 
+// SinkIndex returns the index of the sink the stream is connected to.
+// This changes when the stream is moved to a different sink.
+func (p *PlaybackStream) SinkIndex() uint32 {
+	p.bufferLock.Lock()
+	defer p.bufferLock.Unlock()
+	return p.createReply.SinkIndex
+}
+
+// SinkName returns the name of the sink the stream is connected to, this is the same as the sink's ID.
+// This changes when the stream is moved to a different sink.
+func (p *PlaybackStream) SinkName() string {
+	p.bufferLock.Lock()
+	defer p.bufferLock.Unlock()
+	return p.createReply.SinkName
+}
+
+// Suspended returns wether the sink the stream is connected to is suspended.
+func (p *PlaybackStream) Suspended() bool {
+	p.bufferLock.Lock()
+	defer p.bufferLock.Unlock()
+	return p.createReply.SinkSuspended
+}
+
 // A PlaybackOption supplies configuration when creating streams.
 type PlaybackOption func(*PlaybackStream)
 
@@ -389,6 +1067,31 @@ func PlaybackLatency(seconds float64) PlaybackOption {
 	}
 }
 
+// PlaybackPrebuffer sets the amount of data the server waits for before it starts playing,
+// and before it resumes playing after an underflow.
+// Like PlaybackBufferSize, the amount is the number of samples of all channels.
+// The default is the full buffer size. Lower values make the playback start sooner.
+// A value of 0 disables prebuffering, the playback then also does not stop on underflows.
+func PlaybackPrebuffer(samples int) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.createRequest.BufferPrebufferLength = uint32(samples * p.bytesPerSample)
+	}
+}
+
+// PlaybackMinimumRequest sets the minimum amount of data the server requests at once.
+// Like PlaybackBufferSize, the amount is the number of samples of all channels.
+// Lower values allow refilling the buffer in smaller steps, at the cost of more overhead.
+func PlaybackMinimumRequest(samples int) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.createRequest.BufferMinimumRequest = uint32(samples * p.bytesPerSample)
+	}
+}
+
+// PlaybackVariableRate allows changing the sample rate of the stream with SetSampleRate.
+var PlaybackVariableRate PlaybackOption = func(p *PlaybackStream) {
+	p.createRequest.VariableRate = true
+}
+
 // PlaybackSink sets the sink the stream should send audio to.
 func PlaybackSink(sink *Sink) PlaybackOption {
 	return func(p *PlaybackStream) {
@@ -396,6 +1099,12 @@ func PlaybackSink(sink *Sink) PlaybackOption {
 	}
 }
 
+// PlaybackNoMove prevents the stream from being moved to a different sink,
+// neither by the server nor by the user or other clients.
+var PlaybackNoMove PlaybackOption = func(p *PlaybackStream) {
+	p.createRequest.NoMove = true
+}
+
 // PlaybackMediaName sets the streams media name.
 // This will e.g. be displayed by a volume control application to identity the stream.
 func PlaybackMediaName(name string) PlaybackOption {
@@ -425,6 +1134,84 @@ func PlaybackVolumeChanges(changes chan proto.ChannelVolumes) PlaybackOption {
 	}
 }
 
+// PlaybackMuteChanges sets a channel to receive mute changes on.
+// Like PlaybackVolumeChanges, this includes changes from the system volume mixer.
+//
+// The channel should be buffered (1 element is sufficient). It will be closed
+// when the playback is closed.
+func PlaybackMuteChanges(changes chan bool) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.muteChanges = changes
+	}
+}
+
+// PlaybackVolume sets the initial volume of each channel.
+// Usually the server should choose the volume, see SetVolume.
+func PlaybackVolume(volumes proto.ChannelVolumes) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.createRequest.ChannelVolumes = volumes
+		p.createRequest.VolumeSet = true
+	}
+}
+
+// PlaybackRelativeVolume makes the volume set with PlaybackVolume relative to the sink's volume.
+// This only has an effect if the sink uses flat volumes.
+var PlaybackRelativeVolume PlaybackOption = func(p *PlaybackStream) {
+	p.createRequest.RelativeVolume = true
+}
+
+// PlaybackMuted sets whether the stream is initially muted.
+// Without this option, the server decides, e.g. by restoring the state of an earlier stream of the application.
+func PlaybackMuted(muted bool) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.createRequest.Muted = muted
+		p.createRequest.MutedSet = true
+	}
+}
+
+// PlaybackEvents sets a channel to receive events that are caused by the server or other clients,
+// e.g. when the user moves the stream to a different sink.
+//
+// The channel should be buffered, events are dropped if the channel is full.
+// It will be closed when the playback is closed.
+func PlaybackEvents(events chan<- StreamEvent) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.streamEvents = events
+	}
+}
+
+// PlaybackAutoCork makes the stream pause and resume automatically when the server asks for it.
+// For example, PulseAudio's module-role-cork asks music players to pause while a phone call is active.
+// A stream that was paused by the application is not resumed automatically.
+//
+// Without this option, the requests are only reported as StreamCorkRequested and StreamUncorkRequested events,
+// see PlaybackEvents.
+var PlaybackAutoCork PlaybackOption = func(p *PlaybackStream) {
+	p.autoCork = true
+}
+
+// PlaybackOnEnd sets a function that is called when the stream's reader returned EndOfData or an error,
+// and all data has been played. The argument is the reader's error, or nil for EndOfData.
+// If the stream is paused, stopped or restarted before the data has been played,
+// the function is called with ErrDrainInterrupted.
+//
+// The function is called on a separate goroutine, it may e.g. start the next stream.
+// Calling (*Client).Close from the function doesn't wait for the client's goroutines, see (*Client).Close.
+// This has no effect for streams created with NewPushPlayback.
+func PlaybackOnEnd(f func(error)) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.onEnd = f
+	}
+}
+
+// PlaybackObserver sets an observer that is notified of underflows, overflows and of the time spent in the reader.
+// See ClientObserver for measuring the amount of data sent.
+func PlaybackObserver(o StreamObserver) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.observer = o
+	}
+}
+
 // PlaybackRawOption can be used to create custom options.
 //
 // This is an advanced function, similar to (*Client).RawRequest.
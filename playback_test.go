@@ -0,0 +1,315 @@
+package pulse
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackWrite(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackStereo, PlaybackBufferSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Writable() != 2000 {
+		t.Fatalf("expected 2000 writable bytes, got %d", p.Writable())
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Odd chunk sizes to check that incomplete frames are kept.
+	data := make([]byte, 3001)
+	done := make(chan error)
+	go func() {
+		_, err := io.CopyBuffer(p, &sliceReader{data}, make([]byte, 333))
+		done <- err
+	}()
+
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 2000 })
+	select {
+	case <-done:
+		t.Fatal("write did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.send(proto.OpRequest, new(tags).u32(p.StreamIndex()).u32(2000))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 3000 })
+	if p.Writable() != 1000 {
+		t.Errorf("expected 1000 writable bytes, got %d", p.Writable())
+	}
+
+	if _, err := p.WriteFloat32(make([]float32, 4)); err != ErrWrongFormat {
+		t.Errorf("expected ErrWrongFormat, got %v", err)
+	}
+}
+
+func TestPlaybackWriteClosed(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writable := p.Writable()
+	done := make(chan error)
+	var n int
+	go func() {
+		var err error
+		n, err = p.Write(make([]byte, writable+1))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.Close()
+	if err := <-done; err != ErrStreamClosed {
+		t.Errorf("expected ErrStreamClosed, got %v", err)
+	}
+	// The data that was sent before the stream was closed counts as written.
+	if n != writable {
+		t.Errorf("expected %d bytes to be written, got %d", writable, n)
+	}
+}
+
+// waitFor waits until cond returns true, or fails the test after one second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+type sliceReader struct{ buf []byte }
+
+func (r *sliceReader) Read(buf []byte) (int, error) {
+	if len(r.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(buf, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestPlaybackPrebuffer(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpCreatePlaybackStream:
+			args = a
+		case proto.OpCorkPlaybackStream:
+			// Like a real server, don't start playing before the prebuffer is filled.
+			c.reply(tag, new(tags))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	// A clip that is shorter than the prebuffer.
+	clip := make([]int16, 100)
+	p, err := c.NewPlayback(Int16Reader(func(buf []int16) (int, error) {
+		n := copy(buf, clip)
+		clip = clip[n:]
+		return n, EndOfData
+	}), PlaybackStereo, PlaybackPrebuffer(400), PlaybackMinimumRequest(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[7] != uint32(800) || args[8] != uint32(200) {
+		t.Errorf("expected prebuffer 800 and minimum request 200, got %v and %v", args[7], args[8])
+	}
+
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.received(proto.OpTriggerPlaybackStream) == 1 })
+	if n := s.dataReceived(p.StreamIndex()); n != 200 {
+		t.Errorf("expected 200 bytes, got %d", n)
+	}
+
+	if err := p.Prebuffer(); err != nil {
+		t.Error(err)
+	}
+	if s.received(proto.OpPrebufPlaybackStream) != 1 {
+		t.Error("prebuf request was not sent")
+	}
+
+	// Without prebuffering, the server plays the data immediately.
+	clip = make([]int16, 100)
+	p, err = c.NewPlayback(Int16Reader(func(buf []int16) (int, error) {
+		n := copy(buf, clip)
+		clip = clip[n:]
+		return n, EndOfData
+	}), PlaybackStereo, PlaybackPrebuffer(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 200 })
+	c.Close()
+	if n := s.received(proto.OpTriggerPlaybackStream); n != 1 {
+		t.Errorf("expected 1 trigger request, got %d", n)
+	}
+}
+
+func TestPlaybackLateStarted(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPlayback(Int16Reader(func(buf []int16) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	// A started notification that arrives after the stream was stopped is ignored.
+	s.send(proto.OpStarted, new(tags).u32(p.StreamIndex()))
+	// The reply is received after the notification.
+	if err := p.Prebuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.started) != 0 {
+		t.Error("late started notification was delivered")
+	}
+}
+
+func TestPlaybackStopNow(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPlayback(Int16Reader(func(buf []int16) (int, error) {
+		return len(buf), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.StopNow(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Running() {
+		t.Error("stream is still running")
+	}
+	s.mu.Lock()
+	ops := s.ops[len(s.ops)-2:]
+	s.mu.Unlock()
+	if ops[0] != proto.OpCorkPlaybackStream || ops[1] != proto.OpFlushPlaybackStream {
+		t.Errorf("expected cork and flush, got %v", ops)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Running() {
+		t.Error("stream was not restarted")
+	}
+}
+
+func TestPlaybackStopNowError(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpCorkPlaybackStream && a[1].(bool) {
+			c.error(tag, proto.ErrAccessDenied)
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.StopNow(); err == nil {
+		t.Error("expected an error")
+	}
+	// The server keeps playing, so the stream must still be running.
+	if !p.Running() {
+		t.Error("stream stopped although the cork request failed")
+	}
+}
+
+func TestPlaybackOnEnd(t *testing.T) {
+	s := newTestServer(t)
+	drained := make(chan struct{})
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpDrainPlaybackStream {
+			go func() {
+				<-drained
+				c.reply(tag, new(tags))
+			}()
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	ended := make(chan error, 1)
+	newStream := func() *PlaybackStream {
+		clip := make([]int16, 1000)
+		p, err := c.NewPlayback(Int16Reader(func(buf []int16) (int, error) {
+			n := copy(buf, clip)
+			clip = clip[n:]
+			if len(clip) == 0 {
+				return n, EndOfData
+			}
+			return n, nil
+		}), PlaybackOnEnd(func(err error) { ended <- err }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// OnEnd is called when the server has played all data.
+	newStream()
+	waitFor(t, func() bool { return s.received(proto.OpDrainPlaybackStream) == 1 })
+	select {
+	case err := <-ended:
+		t.Fatalf("called before the data was played: %v", err)
+	default:
+	}
+	drained <- struct{}{}
+	if err := <-ended; err != nil {
+		t.Error(err)
+	}
+
+	p := newStream()
+	waitFor(t, func() bool { return s.received(proto.OpDrainPlaybackStream) == 2 })
+	if err := p.StopNow(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ended; err != ErrDrainInterrupted {
+		t.Errorf("expected ErrDrainInterrupted, got %v", err)
+	}
+	close(drained)
+}
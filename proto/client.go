@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"reflect"
 	"sync"
@@ -24,7 +23,11 @@ type Client struct {
 	timeout    time.Duration
 	err        error // protected by replyM and writeM (hold one to read, hold both to write)
 
+	done chan struct{}
+
 	Callback func(interface{})
+	Logger   Logger   // optional, must be set before the client is opened
+	Observer Observer // optional, must be set before the client is opened
 }
 
 type send struct {
@@ -52,27 +55,48 @@ func (c *Client) Open(rw io.ReadWriter) {
 	c.v = Version(32)
 
 	c.awaitReply = make(map[uint32]AwaitReply)
+	c.done = make(chan struct{})
 	go c.readLoop()
 }
 
+// Done returns a channel that is closed when the client stops reading from the connection,
+// which happens when the connection was closed or a read error occurred.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
 type AwaitReply struct {
 	value interface{}
 	reply chan<- error
 }
 
 func (c *Client) Request(req RequestArgs, rpl Reply) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.RequestContext(ctx, req, rpl)
+}
+
+// RequestContext is like Request, but it waits for the reply until ctx is done instead of using the client's timeout.
+// This is useful for requests that are only answered after some time, like DrainPlaybackStream.
+func (c *Client) RequestContext(ctx context.Context, req RequestArgs, rpl Reply) error {
 	if rpl != nil && req.command() != rpl.IsReplyTo() {
 		panic("pulse: wrong reply type")
 	}
+	if c.Observer != nil {
+		start := time.Now()
+		err := c.request(ctx, req, rpl)
+		c.Observer.RequestDone(opName(req), time.Since(start), err)
+		return err
+	}
+	return c.request(ctx, req, rpl)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
-
+func (c *Client) request(ctx context.Context, req RequestArgs, rpl Reply) error {
 	reply := make(chan error, 1)
 	c.replyM.Lock()
-	if c.err != nil {
+	if err := c.err; err != nil {
 		c.replyM.Unlock()
-		return c.err
+		return err
 	}
 	tag := c.nextID
 	c.nextID++
@@ -90,35 +114,56 @@ func (c *Client) Request(req RequestArgs, rpl Reply) error {
 
 	err := c.Send(0xFFFFFFFF, buf.Bytes())
 	if err != nil {
+		c.replyM.Lock()
+		delete(c.awaitReply, tag)
+		c.replyM.Unlock()
 		return err
 	}
 
 	select {
 	case err := <-reply:
+		if code, ok := err.(Error); ok {
+			return newRequestError(req, tag, code)
+		}
 		return err
 	case <-ctx.Done():
+		c.replyM.Lock()
+		delete(c.awaitReply, tag)
+		c.replyM.Unlock()
 		return ctx.Err()
 	}
-
 }
 
 func (c *Client) Send(index uint32, data []byte) error {
 	c.writeM.Lock()
-	if c.err != nil {
+	if err := c.err; err != nil {
 		c.writeM.Unlock()
-		return c.err
+		return err
 	}
 	c.w.uint32(uint32(len(data)))
 	c.w.uint32(index)
 	c.w.uint64(0)
 	c.w.uint32(0)
 	c.w.flush()
-	c.w.w.Write(data)
+	err := c.w.err
+	if err == nil {
+		_, err = c.w.w.Write(data)
+	}
 	c.writeM.Unlock()
+	if c.Observer != nil && err == nil {
+		c.Observer.BytesSent(index, len(data))
+	}
+	if err != nil {
+		// The stream is in an undefined state after a failed write,
+		// so treat this like a broken connection.
+		c.error(err)
+		return err
+	}
 	return nil
 }
 
 func (c *Client) readLoop() {
+	defer close(c.done)
 	for {
 		length := c.r.uint32()
 		index := c.r.uint32()
@@ -129,6 +174,9 @@ func (c *Client) readLoop() {
 			c.error(c.r.err)
 			return
 		}
+		if c.Observer != nil {
+			c.Observer.BytesReceived(index, int(length))
+		}
 		if index == 0xFFFFFFFF {
 			c.r.byte() // L
 			op := c.r.uint32()
@@ -145,6 +193,8 @@ func (c *Client) readLoop() {
 				c.replyM.Unlock()
 				if ok {
 					a.reply <- err
+				} else {
+					c.log(LevelWarn, "pulseaudio: dropped error reply", "tag", tag, "error", err)
 				}
 			case OpReply:
 				c.replyM.Lock()
@@ -163,6 +213,7 @@ func (c *Client) readLoop() {
 					}
 					a.reply <- nil
 				} else {
+					c.log(LevelWarn, "pulseaudio: dropped reply", "tag", tag)
 					c.r.advance(int(length) - 10)
 				}
 			case OpRequest:
@@ -195,8 +246,10 @@ func (c *Client) readLoop() {
 				message = &Started{}
 			case OpPlaybackBufferAttrChanged:
 				message = &PlaybackBufferAttrChanged{}
+			case OpRecordBufferAttrChanged:
+				message = &RecordBufferAttrChanged{}
 			default:
-				fmt.Println(op)
+				c.log(LevelWarn, "pulseaudio: unknown message", "op", op, "tag", tag, "length", length)
 				c.r.advance(int(length) - 10)
 			}
 			if message != nil {
@@ -226,7 +279,7 @@ func (c *Client) error(err error) {
 	for _, r := range r {
 		r.reply <- err
 	}
-	if errors.Is(err, io.EOF) {
+	if errors.Is(err, io.EOF) && c.Callback != nil {
 		c.Callback(&ConnectionClosed{})
 	}
 }
@@ -27,6 +27,17 @@ func init() {
 // https://www.freedesktop.org/wiki/Software/PulseAudio/Documentation/User/ServerStrings/
 // If the server string is empty, the environment variable PULSE_SERVER will be used.
 func Connect(server string) (*Client, net.Conn, error) {
+	c := &Client{}
+	conn, err := c.Dial(server)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, conn, nil
+}
+
+// Dial connects c to the pulse server, see Connect.
+// It can be used instead of Connect to set fields such as Logger before any messages are exchanged.
+func (c *Client) Dial(server string) (net.Conn, error) {
 	var sstr []serverString
 	if server != "" {
 		sstr = parseServerString(server)
@@ -36,15 +47,15 @@ func Connect(server string) (*Client, net.Conn, error) {
 		sstr = defaultServerStrings()
 	}
 	if len(sstr) == 0 {
-		return nil, nil, errors.New("pulseaudio: no valid server")
+		return nil, errors.New("pulseaudio: no valid server")
 	}
-	c := &Client{
-		timeout: 1 * time.Second,
+	if c.timeout == 0 {
+		c.timeout = 1 * time.Second
 	}
 
 	localname, err := os.Hostname()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	var lastErr error
@@ -54,6 +65,7 @@ func Connect(server string) (*Client, net.Conn, error) {
 		}
 		conn, err := net.Dial(s.protocol, s.addr)
 		if err != nil {
+			c.log(LevelDebug, "pulseaudio: dial failed", "network", s.protocol, "address", s.addr, "error", err)
 			lastErr = err
 			continue
 		}
@@ -86,12 +98,18 @@ func Connect(server string) (*Client, net.Conn, error) {
 			lastErr = err
 			continue
 		}
+		clientVersion := c.Version()
 		c.SetVersion(authReply.Version)
+		c.log(LevelInfo, "pulseaudio: protocol version negotiated",
+			"address", s.addr,
+			"client", clientVersion.Version(),
+			"server", authReply.Version.Version(),
+			"version", c.Version().Version())
 
-		return c, conn, nil
+		return conn, nil
 	}
 
-	return nil, nil, lastErr
+	return nil, lastErr
 }
 
 type serverString struct {
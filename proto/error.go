@@ -1,5 +1,11 @@
 package proto
 
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
 type Error uint32
 
 const (
@@ -91,3 +97,48 @@ func (e Error) Error() string {
 	}
 	return "pulseaudio: invalid error code"
 }
+
+// A RequestError is returned by (*Client).Request when the server replies with an error.
+// It records which command failed and which object it referred to.
+// The underlying error code can be checked with errors.Is, e.g. errors.Is(err, ErrNoSuchEntity).
+//
+// Before RequestError was introduced, the error code was returned directly.
+// Code that compares errors with ==, like err == ErrNoSuchEntity, no longer matches and must use errors.Is.
+type RequestError struct {
+	Op     string // name of the request type, e.g. "GetSinkInputInfo"
+	Tag    uint32 // tag of the failed request
+	Code   Error  // error code sent by the server
+	Object string // the object the request referred to, e.g. "SinkInputIndex=3", or "" if unknown
+}
+
+func (e *RequestError) Error() string {
+	msg := "pulseaudio: " + e.Op
+	if e.Object != "" {
+		msg += " " + e.Object
+	}
+	return msg + ": " + strings.TrimPrefix(e.Code.Error(), "pulseaudio: ")
+}
+
+func (e *RequestError) Unwrap() error { return e.Code }
+
+func newRequestError(req RequestArgs, tag uint32, code Error) *RequestError {
+	v := reflect.ValueOf(req).Elem()
+	e := &RequestError{Op: opName(req), Tag: tag, Code: code}
+	// Use the first index or name field that is set to describe the object.
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		switch f := v.Field(i).Interface().(type) {
+		case uint32:
+			if strings.HasSuffix(name, "Index") && f != Undefined {
+				e.Object = fmt.Sprintf("%s=%d", name, f)
+				return e
+			}
+		case string:
+			if strings.HasSuffix(name, "Name") && f != "" {
+				e.Object = fmt.Sprintf("%s=%q", name, f)
+				return e
+			}
+		}
+	}
+	return e
+}
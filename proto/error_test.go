@@ -0,0 +1,78 @@
+package proto
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// replyWithError answers the next request read from conn with an error packet.
+func replyWithError(t *testing.T, conn net.Conn, code Error) {
+	var desc [20]byte
+	if _, err := io.ReadFull(conn, desc[:]); err != nil {
+		t.Error(err)
+		return
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(desc[:]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Error(err)
+		return
+	}
+	tag := binary.BigEndian.Uint32(payload[6:])
+
+	var out [35]byte
+	binary.BigEndian.PutUint32(out[0:], 15)
+	binary.BigEndian.PutUint32(out[4:], 0xFFFFFFFF)
+	out[20] = 'L'
+	binary.BigEndian.PutUint32(out[21:], OpError)
+	out[25] = 'L'
+	binary.BigEndian.PutUint32(out[26:], tag)
+	out[30] = 'L'
+	binary.BigEndian.PutUint32(out[31:], uint32(code))
+	if _, err := conn.Write(out[:]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	var c Client
+	c.SetTimeout(time.Second)
+	c.Open(client)
+
+	go replyWithError(t, server, ErrNoSuchEntity)
+	err := c.Request(&GetSinkInputInfo{SinkInputIndex: 3}, &GetSinkInputInfoReply{})
+
+	var rerr *RequestError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected *RequestError, got %#v", err)
+	}
+	if rerr.Op != "GetSinkInputInfo" || rerr.Object != "SinkInputIndex=3" || rerr.Code != ErrNoSuchEntity {
+		t.Errorf("unexpected error fields: %+v", rerr)
+	}
+	if !errors.Is(err, ErrNoSuchEntity) {
+		t.Error("errors.Is(err, ErrNoSuchEntity) should be true")
+	}
+	if want := "pulseaudio: GetSinkInputInfo SinkInputIndex=3: no such entity"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestSendError(t *testing.T) {
+	client, server := net.Pipe()
+	server.Close()
+	var c Client
+	c.SetTimeout(time.Second)
+	c.Open(client)
+
+	if err := c.Send(0, []byte{1, 2, 3}); err == nil {
+		t.Error("expected write error")
+	}
+	if err := c.Request(&Stat{}, &StatReply{}); err == nil {
+		t.Error("expected error after failed write")
+	}
+}
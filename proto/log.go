@@ -0,0 +1,41 @@
+package proto
+
+// A LogLevel is the importance of a log record.
+// The values are the same as those of the levels defined by log/slog.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "INVALID"
+}
+
+// A Logger receives log records from a Client.
+//
+// args contains alternating keys and values, like the arguments to slog.Logger.Log.
+// Keys are always strings.
+// Log may be called from the client's read goroutine, it should not block.
+type Logger interface {
+	Log(level LogLevel, msg string, args ...interface{})
+}
+
+func (c *Client) log(level LogLevel, msg string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Log(level, msg, args...)
+	}
+}
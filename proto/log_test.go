@@ -0,0 +1,40 @@
+package proto
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+type testLogger chan string
+
+func (l testLogger) Log(level LogLevel, msg string, args ...interface{}) {
+	l <- level.String() + " " + msg
+}
+
+func TestLogUnknownMessage(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	log := make(testLogger, 1)
+	c := Client{Logger: log}
+	c.Open(client)
+
+	var out [30]byte
+	binary.BigEndian.PutUint32(out[0:], 10)
+	binary.BigEndian.PutUint32(out[4:], 0xFFFFFFFF)
+	out[20] = 'L'
+	binary.BigEndian.PutUint32(out[21:], 1000)
+	out[25] = 'L'
+	binary.BigEndian.PutUint32(out[26:], 0xFFFFFFFF)
+	go server.Write(out[:])
+
+	select {
+	case msg := <-log:
+		if want := "WARN pulseaudio: unknown message"; msg != want {
+			t.Errorf("expected %q, got %q", want, msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("no log message received")
+	}
+}
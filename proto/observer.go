@@ -0,0 +1,30 @@
+package proto
+
+import (
+	"reflect"
+	"time"
+)
+
+// An Observer receives measurements of a Client that can be used for metrics.
+//
+// A Client reports requests and the bytes sent and received on the connection,
+// including audio data; streamIndex is 0xFFFFFFFF for command packets.
+//
+// Methods may be called from the client's read goroutine, they should return quickly.
+// Embed NopObserver to implement only some of the methods.
+type Observer interface {
+	RequestDone(op string, d time.Duration, err error)
+	BytesSent(streamIndex uint32, n int)
+	BytesReceived(streamIndex uint32, n int)
+}
+
+// NopObserver implements Observer, all methods do nothing.
+type NopObserver struct{}
+
+func (NopObserver) RequestDone(op string, d time.Duration, err error) {}
+func (NopObserver) BytesSent(streamIndex uint32, n int)               {}
+func (NopObserver) BytesReceived(streamIndex uint32, n int)           {}
+
+func opName(req RequestArgs) string {
+	return reflect.TypeOf(req).Elem().Name()
+}
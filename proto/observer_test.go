@@ -0,0 +1,37 @@
+package proto
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type testObserver struct {
+	NopObserver
+	op   string
+	err  error
+	sent int
+}
+
+func (o *testObserver) RequestDone(op string, d time.Duration, err error) { o.op, o.err = op, err }
+func (o *testObserver) BytesSent(streamIndex uint32, n int)               { o.sent += n }
+
+func TestObserver(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	o := &testObserver{}
+	c := Client{Observer: o}
+	c.SetTimeout(time.Second)
+	c.Open(client)
+
+	go replyWithError(t, server, ErrAccessDenied)
+	c.Request(&KillClient{ClientIndex: 1}, nil)
+
+	if o.op != "KillClient" || !errors.Is(o.err, ErrAccessDenied) {
+		t.Errorf("unexpected RequestDone(%q, %v)", o.op, o.err)
+	}
+	if o.sent == 0 {
+		t.Error("BytesSent was not called")
+	}
+}
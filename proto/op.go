@@ -994,3 +994,10 @@ type PlaybackBufferAttrChanged struct {
 	BufferMinimumRequest  uint32
 	SinkLatency           Microseconds
 }
+
+type RecordBufferAttrChanged struct {
+	StreamIndex     uint32
+	BufferMaxLength uint32
+	BufferFragSize  uint32
+	SourceLatency   Microseconds
+}
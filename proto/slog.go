@@ -0,0 +1,27 @@
+//go:build go1.21
+// +build go1.21
+
+package proto
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogLogger returns a Logger that sends records to a slog.Handler.
+func SlogLogger(h slog.Handler) Logger {
+	return slogLogger{h}
+}
+
+type slogLogger struct{ h slog.Handler }
+
+func (l slogLogger) Log(level LogLevel, msg string, args ...interface{}) {
+	ctx := context.Background()
+	if !l.h.Enabled(ctx, slog.Level(level)) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), slog.Level(level), msg, 0)
+	r.Add(args...)
+	l.h.Handle(ctx, r)
+}
@@ -1,6 +1,9 @@
 package proto
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
 const Undefined = 0xFFFFFFFF
 
@@ -42,7 +45,15 @@ const (
 )
 
 const (
-	EncodingPCM = 1
+	EncodingAny              = 0
+	EncodingPCM              = 1
+	EncodingAC3IEC61937      = 2
+	EncodingEAC3IEC61937     = 3
+	EncodingMPEGIEC61937     = 4
+	EncodingDTSIEC61937      = 5
+	EncodingMPEG2AACIEC61937 = 6
+	EncodingTrueHDIEC61937   = 7
+	EncodingDTSHDIEC61937    = 8
 )
 
 type SampleSpec struct {
@@ -53,6 +64,9 @@ type SampleSpec struct {
 
 type Microseconds uint64
 
+// Duration converts m to a time.Duration.
+func (m Microseconds) Duration() time.Duration { return time.Duration(m) * time.Microsecond }
+
 type ChannelMap []byte
 
 type ChannelVolumes []Volume
@@ -72,6 +86,16 @@ type Time struct {
 	Microseconds uint32
 }
 
+// NewTime converts a time.Time to a Time.
+func NewTime(t time.Time) Time {
+	return Time{Seconds: uint32(t.Unix()), Microseconds: uint32(t.Nanosecond() / 1000)}
+}
+
+// Time converts t to a time.Time.
+func (t Time) Time() time.Time {
+	return time.Unix(int64(t.Seconds), int64(t.Microseconds)*1000)
+}
+
 type Volume uint32
 
 const (
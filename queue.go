@@ -0,0 +1,281 @@
+package pulse
+
+import (
+	"io"
+	"sync"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// A Queue is a playback stream that plays a sequence of readers without gaps between them,
+// e.g. the tracks of an album.
+// Readers are switched at frame boundaries, so consecutive items play exactly as if they were a single file.
+//
+// All methods of PlaybackStream can be used on a Queue.
+// If the queue runs out of items, the stream stops as if the reader had returned EndOfData;
+// items that are added after that are played after calling Start.
+// Unlike (*PlaybackStream).Start, Start then keeps the audio that is still buffered on the server,
+// and the new items follow it without a gap. Audio of a queue that was stopped otherwise is discarded.
+type Queue struct {
+	*PlaybackStream
+
+	readLock sync.Mutex // held while reading, so that Skip does not change the item that is being read
+
+	mu     sync.Mutex
+	nextID int
+	items  []*queueItem // items that have not been read completely
+	starts []queueStart // positions at which items started, in the order they were read
+	offset int64        // number of bytes written to the server, the same as the server's write index
+	pad    int          // number of zero bytes needed to complete the last frame of an item
+	ended  bool         // whether the queue ran out of items
+	end    int64        // offset at which the queue ran out of items
+}
+
+type queueItem struct {
+	id      int
+	r       io.Reader
+	read    int64
+	started bool
+}
+
+type queueStart struct {
+	id     int
+	offset int64
+}
+
+// NewQueue creates a playback stream that plays readers added with Enqueue one after another.
+// The format must be one of the constants defined in the proto package,
+// all readers must provide data in this format and with the stream's channel count.
+//
+// The created stream wil not be running, it must be started with Start().
+func (c *Client) NewQueue(format byte, opts ...PlaybackOption) (*Queue, error) {
+	check(format)
+	q := &Queue{}
+	p, err := c.newPlayback(format, queueReader{q, format}, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.queue = q
+	q.PlaybackStream = p
+	return q, nil
+}
+
+// Enqueue adds a reader to the end of the queue.
+// The reader should return io.EOF or EndOfData after its last sample.
+// The returned ID identifies the item in the results of Current.
+func (q *Queue) Enqueue(r io.Reader) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id := q.nextID
+	q.nextID++
+	q.items = append(q.items, &queueItem{id: id, r: r})
+	return id
+}
+
+// Len returns the number of items that have not been read completely,
+// including the item that is currently playing.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Current returns the ID of the item that is currently playing, or -1 if no item is playing.
+// The item is determined from the stream position, so the result is accurate even if the
+// server has already buffered the beginning of the next item.
+func (q *Queue) Current() (int, error) {
+	pos, err := q.Position()
+	if err != nil {
+		return -1, err
+	}
+	pos *= int64(q.bytesPerSample * q.Channels())
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ended && pos >= q.end {
+		return -1, nil
+	}
+	current := -1
+	for i, s := range q.starts {
+		if s.offset > pos {
+			break
+		}
+		current = i
+	}
+	if current < 0 {
+		return -1, nil
+	}
+	// Items before the current one will not be needed again.
+	q.starts = q.starts[current:]
+	return q.starts[0].id, nil
+}
+
+// Skip stops the item that is currently playing and continues with the next item.
+// If no item is playing, the first item of the queue is removed.
+//
+// Audio already buffered on the server is discarded. If the next item has already been started,
+// it is played from the beginning if its reader implements io.Seeker, otherwise the part
+// that was buffered is lost.
+// A running queue keeps running unless it has no more items, a paused queue is stopped.
+func (q *Queue) Skip() error {
+	current, err := q.Current()
+	if err != nil {
+		return err
+	}
+	running := q.Running()
+	if err := q.StopNow(); err != nil {
+		return err
+	}
+
+	q.readLock.Lock()
+	q.mu.Lock()
+	if current < 0 && len(q.items) > 0 {
+		current = q.items[0].id
+	}
+	for len(q.items) > 0 && q.items[0].id <= current {
+		q.items = q.items[1:]
+	}
+	if len(q.items) > 0 && q.items[0].started {
+		item := q.items[0]
+		if s, ok := item.r.(io.Seeker); ok {
+			if _, err := s.Seek(0, io.SeekStart); err == nil {
+				item.read = 0
+			}
+		}
+		item.started = false
+	}
+	q.pad = 0
+	empty := len(q.items) == 0
+	q.mu.Unlock()
+	q.readLock.Unlock()
+
+	if err := q.sync(); err != nil {
+		return err
+	}
+	if running && !empty {
+		return q.PlaybackStream.Start()
+	}
+	return nil
+}
+
+// Clear removes all items that have not started playing.
+// The current item is not affected, neither is an item whose beginning has already been sent to the server.
+// Use Clear followed by Skip to stop playback.
+func (q *Queue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) > 0 && q.items[0].started {
+		q.items = q.items[:1]
+	} else {
+		q.items = nil
+	}
+}
+
+// prepareStart is called by startPlayback before the queue is started.
+// If the queue ran out of items and its audio has not been flushed since, the audio is kept.
+// Otherwise it is discarded like for other streams.
+func (q *Queue) prepareStart() error {
+	if err := q.UpdateTiming(); err != nil {
+		return err
+	}
+	q.timingLock.Lock()
+	writeIndex := q.timing.writeIndex
+	q.timingLock.Unlock()
+	q.mu.Lock()
+	// Flushing, e.g. by StopNow, resets the server's write index.
+	gapless := q.ended && q.offset == writeIndex
+	q.ended = false
+	q.mu.Unlock()
+	if gapless {
+		return nil
+	}
+	if err := q.c.request(&proto.FlushPlaybackStream{StreamIndex: q.index}, nil); err != nil {
+		return err
+	}
+	return q.sync()
+}
+
+// sync sets the offset to the server's write index. The stream must be stopped.
+func (q *Queue) sync() error {
+	if err := q.UpdateTiming(); err != nil {
+		return err
+	}
+	q.timingLock.Lock()
+	offset := q.timing.writeIndex
+	q.timingLock.Unlock()
+	q.mu.Lock()
+	q.offset = offset
+	q.starts = nil
+	q.ended = false
+	q.mu.Unlock()
+	return nil
+}
+
+// read fills buf with data from the items of the queue.
+func (q *Queue) read(buf []byte) (int, error) {
+	q.readLock.Lock()
+	defer q.readLock.Unlock()
+	frame := int64(q.bytesPerSample * q.Channels())
+	n := 0
+	var err error
+	for n < len(buf) && err == nil {
+		q.mu.Lock()
+		if q.pad > 0 {
+			m := q.pad
+			if m > len(buf)-n {
+				m = len(buf) - n
+			}
+			q.fillSilence(buf[n : n+m])
+			n += m
+			q.pad -= m
+			q.mu.Unlock()
+			continue
+		}
+		if len(q.items) == 0 {
+			q.ended = true
+			q.end = q.offset + int64(n)
+			q.mu.Unlock()
+			err = EndOfData
+			break
+		}
+		item := q.items[0]
+		if !item.started {
+			item.started = true
+			q.starts = append(q.starts, queueStart{item.id, q.offset + int64(n)})
+		}
+		q.mu.Unlock()
+
+		var m int
+		m, err = item.r.Read(buf[n:])
+		n += m
+		item.read += int64(m)
+		if err == nil {
+			if m == 0 {
+				break
+			}
+			continue
+		}
+
+		// The item is finished, either because it ended or because of an error.
+		q.mu.Lock()
+		q.items = q.items[1:]
+		if rem := item.read % frame; rem != 0 {
+			q.pad = int(frame - rem)
+		}
+		q.mu.Unlock()
+		if err == io.EOF || err == EndOfData {
+			err = nil
+		}
+	}
+	q.mu.Lock()
+	q.offset += int64(n)
+	q.mu.Unlock()
+	return n, err
+}
+
+type queueReader struct {
+	q      *Queue
+	format byte
+}
+
+func (r queueReader) Read(buf []byte) (int, error) { return r.q.read(buf) }
+func (r queueReader) Format() byte                 { return r.format }
@@ -0,0 +1,197 @@
+package pulse
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// replyIndex makes the server answer latency requests with the given read index, which can be changed while the test runs.
+// The write index is the same as the read index.
+func replyIndex(s *testServer, index *int64) {
+	s.handle = func(c *serverConn, op, tag uint32, args []interface{}) bool {
+		if op != proto.OpGetPlaybackLatency {
+			return false
+		}
+		requestTime := args[1].(proto.Time)
+		i := atomic.LoadInt64(index)
+		c.reply(tag, new(tags).
+			usec(0).usec(0).boolean(true).
+			time(requestTime).time(requestTime).
+			i64(i).i64(i).
+			u64r(0).u64r(0))
+		return true
+	}
+}
+
+func TestQueueRead(t *testing.T) {
+	s := newTestServer(t)
+	var index int64
+	replyIndex(s, &index)
+	c := s.client()
+	defer c.Close()
+
+	q, err := c.NewQueue(proto.FormatInt16LE, PlaybackSampleRate(8000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := q.Enqueue(strings.NewReader(strings.Repeat("a", 1001)))
+	b := q.Enqueue(strings.NewReader(strings.Repeat("b", 2000)))
+
+	buf := make([]byte, 4000)
+	n, err := q.read(buf)
+	if n != 3002 || err != EndOfData {
+		t.Fatalf("read returned %d, %v", n, err)
+	}
+	// The incomplete frame at the end of the first item is filled with silence.
+	if string(buf[:n]) != strings.Repeat("a", 1001)+"\x00"+strings.Repeat("b", 2000) {
+		t.Error("wrong data")
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected an empty queue, got %d items", q.Len())
+	}
+
+	for _, c := range []struct {
+		index   int64
+		current int
+	}{{0, a}, {1000, a}, {1002, b}, {3000, b}, {3002, -1}} {
+		atomic.StoreInt64(&index, c.index)
+		if current, err := q.Current(); current != c.current || err != nil {
+			t.Errorf("at %d: Current returned %d, %v, expected %d", c.index, current, err, c.current)
+		}
+	}
+}
+
+func TestQueueReadUint8(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	q, err := c.NewQueue(proto.FormatUint8, PlaybackStereo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Enqueue(strings.NewReader("aaa"))
+	q.Enqueue(strings.NewReader("bb"))
+	buf := make([]byte, 10)
+	n, err := q.read(buf)
+	// Silence is 0x80 in the unsigned format.
+	if string(buf[:n]) != "aaa\x80bb" || err != EndOfData {
+		t.Errorf("read returned %q, %v", buf[:n], err)
+	}
+}
+
+func TestQueueSkip(t *testing.T) {
+	s := newTestServer(t)
+	var index int64
+	replyIndex(s, &index)
+	c := s.client()
+	defer c.Close()
+
+	// The server requests 1600 bytes when the stream is started.
+	q, err := c.NewQueue(proto.FormatInt16LE, PlaybackSampleRate(8000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := q.Enqueue(strings.NewReader(strings.Repeat("a", 1000)))
+	b := q.Enqueue(strings.NewReader(strings.Repeat("b", 10000)))
+	q.Enqueue(strings.NewReader(strings.Repeat("c", 10000)))
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.dataReceived(q.StreamIndex()) == 1600 })
+	if current, err := q.Current(); current != a || err != nil {
+		t.Errorf("Current returned %d, %v, expected %d", current, err, a)
+	}
+
+	// The beginning of b was already sent, it is played again after skipping a.
+	atomic.StoreInt64(&index, 500)
+	if err := q.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if !q.Running() {
+		t.Error("stream stopped")
+	}
+	waitFor(t, func() bool { return s.dataReceived(q.StreamIndex()) == 3200 })
+	if current, err := q.Current(); current != b || err != nil {
+		t.Errorf("Current returned %d, %v, expected %d", current, err, b)
+	}
+	q.mu.Lock()
+	read := q.items[0].read
+	q.mu.Unlock()
+	if read != 1600 {
+		t.Errorf("expected 1600 bytes of b to be read, got %d", read)
+	}
+
+	q.Clear()
+	if q.Len() != 1 {
+		t.Errorf("expected 1 item, got %d", q.Len())
+	}
+	if err := q.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if q.Running() || q.Len() != 0 {
+		t.Errorf("expected a stopped, empty queue, running: %v, %d items", q.Running(), q.Len())
+	}
+}
+
+func TestQueueGapless(t *testing.T) {
+	s := newTestServer(t)
+	var index int64
+	replyIndex(s, &index)
+	c := s.client()
+	defer c.Close()
+
+	q, err := c.NewQueue(proto.FormatInt16LE, PlaybackSampleRate(8000), PlaybackSyncGroup(c.NewSyncGroup()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The write index is used as the start of the queue, also when starting through the sync group.
+	atomic.StoreInt64(&index, 400)
+	a := q.Enqueue(strings.NewReader(strings.Repeat("a", 1000)))
+	if err := q.group.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return !q.Running() })
+	if current, err := q.Current(); current != a || err != nil {
+		t.Errorf("Current returned %d, %v, expected %d", current, err, a)
+	}
+
+	// The queue ran out of items while a is still playing, b is played after it.
+	atomic.StoreInt64(&index, 1400)
+	flushes := s.received(proto.OpFlushPlaybackStream)
+	b := q.Enqueue(strings.NewReader(strings.Repeat("b", 1000)))
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if s.received(proto.OpFlushPlaybackStream) != flushes {
+		t.Error("the remaining audio was flushed")
+	}
+	waitFor(t, func() bool { return s.dataReceived(q.StreamIndex()) == 2000 })
+	for _, c := range []struct {
+		index   int64
+		current int
+	}{{1000, a}, {1400, b}} {
+		atomic.StoreInt64(&index, c.index)
+		if current, err := q.Current(); current != c.current || err != nil {
+			t.Errorf("at %d: Current returned %d, %v, expected %d", c.index, current, err, c.current)
+		}
+	}
+
+	// After StopNow, the audio is gone and the write index no longer matches.
+	waitFor(t, func() bool { return !q.Running() })
+	if err := q.StopNow(); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&index, 2000)
+	q.Enqueue(strings.NewReader(strings.Repeat("c", 1000)))
+	flushes = s.received(proto.OpFlushPlaybackStream)
+	if err := q.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if s.received(proto.OpFlushPlaybackStream) != flushes+1 {
+		t.Error("the stream was not flushed")
+	}
+}
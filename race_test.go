@@ -0,0 +1,364 @@
+package pulse
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// The tests in this file exercise streams from several goroutines at once.
+// They are most useful with the race detector: go test -race
+
+// concurrently runs each function in its own goroutine, n times, and waits until all are done.
+func concurrently(n int, fs ...func()) {
+	var wg sync.WaitGroup
+	for _, f := range fs {
+		wg.Add(1)
+		go func(f func()) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f()
+			}
+		}(f)
+	}
+	wg.Wait()
+}
+
+func TestPlaybackRace(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPlayback(Uint8Reader(func(buf []byte) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrently(50,
+		func() { p.Start() },
+		func() { p.Stop() },
+		func() { p.Pause(); p.Resume() },
+		func() { s.send(proto.OpUnderflow, new(tags).u32(p.StreamIndex()).i64(0)) },
+		func() { p.Running(); p.Closed(); p.Error(); p.Underflow(); p.Underflows() },
+	)
+	concurrently(1,
+		func() { p.Close() },
+		func() { p.Running(); p.Closed(); p.Error() },
+	)
+}
+
+func TestPushPlaybackRace(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	concurrently(1,
+		func() {
+			for {
+				if _, err := p.Write(make([]byte, 100)); err != nil {
+					return
+				}
+			}
+		},
+		func() {
+			for i := 0; i < 50; i++ {
+				s.send(proto.OpRequest, new(tags).u32(p.StreamIndex()).u32(100))
+				p.Writable()
+			}
+			p.Close()
+		},
+	)
+	if p.Error() != nil {
+		t.Error(p.Error())
+	}
+}
+
+func TestRecordRace(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatUint8, RecordReadBufferSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Start()
+	read := make(chan error)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				read <- err
+				return
+			}
+		}
+	}()
+	concurrently(50,
+		func() { r.Start(); r.Stop() },
+		func() { r.Pause(); r.Resume() },
+		func() { s.conns[0].sendData(r.StreamIndex(), make([]byte, 10)) },
+		func() { s.conns[0].sendData(r.StreamIndex(), make([]byte, 100)) },
+		func() {
+			r.Running()
+			r.Closed()
+			r.Error()
+			r.Overflow()
+			r.Overflows()
+			r.Readable()
+		},
+	)
+	r.Close()
+	if err := <-read; err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestRecordWriterErrorRace(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	fail := errors.New("fail")
+	r, err := c.NewRecord(Uint8Writer(func(buf []byte) (int, error) { return 0, fail }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Start()
+	// The writer's error stops the stream from a different goroutine.
+	concurrently(20,
+		func() { s.conns[0].sendData(r.StreamIndex(), make([]byte, 10)) },
+		func() { r.Running(); r.Error() },
+	)
+	waitFor(t, func() bool { return !r.Running() })
+	if r.Error() != fail {
+		t.Errorf("expected the writer's error, got %v", r.Error())
+	}
+	r.Start()
+	if r.Error() != nil {
+		t.Errorf("Start did not reset the error: %v", r.Error())
+	}
+}
+
+func TestConnectionLostRace(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewPullRecord(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrently(1,
+		func() { s.conns[0].conn.Close() },
+		func() {
+			for !p.Closed() {
+				p.Error()
+			}
+		},
+		func() {
+			for !r.Closed() {
+				r.Error()
+			}
+		},
+	)
+	if p.Error() != ErrConnectionClosed || r.Error() != ErrConnectionClosed {
+		t.Errorf("unexpected errors %v, %v", p.Error(), r.Error())
+	}
+}
+
+func TestCloseKillRace(t *testing.T) {
+	s := newTestServer(t)
+	deleting := make(chan struct{}, 2)
+	// The delete requests are never answered, the connection is lost while they are in flight.
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpDeletePlaybackStream || op == proto.OpDeleteRecordStream {
+			deleting <- struct{}{}
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewPullRecord(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrently(1,
+		func() { p.Close() },
+		func() { r.Close() },
+		func() {
+			<-deleting
+			<-deleting
+			s.send(proto.OpPlaybackStreamKilled, new(tags).u32(p.StreamIndex()))
+			s.send(proto.OpRecordStreamKilled, new(tags).u32(r.StreamIndex()))
+			s.conns[0].conn.Close()
+		},
+	)
+	if !p.Closed() || !r.Closed() {
+		t.Error("streams were not closed")
+	}
+	// Close is idempotent, even after the stream was released.
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCloseKillDisconnectRace(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		s := newTestServer(t)
+		c := s.client()
+
+		p, err := c.NewPushPlayback(proto.FormatUint8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := c.NewPullRecord(proto.FormatUint8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only one of them releases each stream, otherwise closing a channel twice panics.
+		concurrently(1,
+			func() { p.Close() },
+			func() { r.Close() },
+			func() { s.send(proto.OpPlaybackStreamKilled, new(tags).u32(p.StreamIndex())) },
+			func() { s.send(proto.OpRecordStreamKilled, new(tags).u32(r.StreamIndex())) },
+			func() { s.conns[0].conn.Close() },
+			func() { c.Close() },
+		)
+		if !p.Closed() || !r.Closed() {
+			t.Error("streams were not closed")
+		}
+	}
+}
+
+func TestCorkRace(t *testing.T) {
+	s := newTestServer(t)
+	var mu sync.Mutex
+	corked := map[uint32]bool{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op == proto.OpCorkPlaybackStream || op == proto.OpCorkRecordStream {
+			mu.Lock()
+			corked[a[0].(uint32)] = a[1].(bool)
+			mu.Unlock()
+			// Answer late, so that other calls run while the request is in flight.
+			go func() {
+				time.Sleep(time.Millisecond)
+				c.defaultReply(op, tag, a)
+			}()
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPlayback(Uint8Reader(func(buf []byte) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewRecord(Uint8Writer(func(buf []byte) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrently(50,
+		func() { p.Start(); r.Start() },
+		func() { p.StopNow(); r.Stop() },
+		func() { p.Pause(); r.Pause() },
+		func() { p.Resume(); r.Resume() },
+	)
+	// The state must match the last cork request, a running stream must not be corked.
+	mu.Lock()
+	defer mu.Unlock()
+	if p.Running() == corked[p.StreamIndex()] {
+		t.Errorf("playback stream: running %v, corked %v", p.Running(), corked[p.StreamIndex()])
+	}
+	if r.Running() == corked[r.StreamIndex()] {
+		t.Errorf("record stream: running %v, corked %v", r.Running(), corked[r.StreamIndex()])
+	}
+}
+
+func TestStopWhileResuming(t *testing.T) {
+	s := newTestServer(t)
+	// The reply to the next uncork request is held until the channel sent to hold is closed.
+	hold := make(chan chan struct{}, 1)
+	held := make(chan struct{})
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if (op == proto.OpCorkPlaybackStream || op == proto.OpCorkRecordStream) && !a[1].(bool) {
+			select {
+			case release := <-hold:
+				held <- struct{}{}
+				go func() {
+					<-release
+					c.defaultReply(op, tag, a)
+				}()
+				return true
+			default:
+			}
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPlayback(Uint8Reader(func(buf []byte) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewRecord(Uint8Writer(func(buf []byte) (int, error) { return len(buf), nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range []struct {
+		start, pause, resume, stop func() error
+		running                    func() bool
+	}{
+		{p.Start, p.Pause, p.Resume, func() error { p.Stop(); return nil }, p.Running},
+		{r.Start, r.Pause, r.Resume, r.Stop, r.Running},
+	} {
+		if err := st.start(); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.pause(); err != nil {
+			t.Fatal(err)
+		}
+		release := make(chan struct{})
+		hold <- release
+		resumed := make(chan error)
+		go func() { resumed <- st.resume() }()
+		<-held
+		stopped := make(chan error)
+		go func() { stopped <- st.stop() }()
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		if err := <-resumed; err != nil {
+			t.Fatal(err)
+		}
+		if err := <-stopped; err != nil {
+			t.Fatal(err)
+		}
+		// Stop was called after Resume, so the stream must be stopped.
+		if st.running() {
+			t.Error("stream is running after Stop")
+		}
+	}
+}
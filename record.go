@@ -1,18 +1,43 @@
 package pulse
 
-import "github.com/jfreymuth/pulse/proto"
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
 
 // A RecordStream is used for recording audio.
-// When creating a stream, the user must provide a callback that will be called with the recorded audio data.
+// When creating a stream, the user must either provide a callback that will be called with the recorded audio data,
+// or create the stream with NewPullRecord and read the data using Read.
 type RecordStream struct {
 	c *Client
 
-	index uint32
-	state streamState
-	err   error
+	index     uint32
+	state     *stateMachine
+	err       streamError
+	overflows xrunCounter
+
+	w        Writer
+	observer StreamObserver
+
+	events        chan struct{}
+	eventsLock    sync.Mutex // protects events and streamEvents
+	volumeChanges chan proto.ChannelVolumes
+	muteChanges   chan bool
+	streamEvents  chan<- StreamEvent
 
-	w Writer
+	// pull mode, used if w is nil
+	pullLock       sync.Mutex
+	pullCond       *sync.Cond  // signaled when data arrives or the stream is closed
+	ring           *ringBuffer // protected by pullLock
+	ringSize       int
+	overflowPolicy OverflowPolicy
+	overflowed     bool // protected by pullLock
 
+	bufferLock     sync.Mutex // protects the buffer attributes and the source in createReply, which can change at any time
 	createRequest  proto.CreateRecordStream
 	createReply    proto.CreateRecordStreamReply
 	bytesPerSample int
@@ -23,21 +48,39 @@ type RecordStream struct {
 // The created stream wil not be running, it must be started with Start().
 // The order of options is important in some cases, see the documentation of the individual RecordOptions.
 func (c *Client) NewRecord(w Writer, opts ...RecordOption) (*RecordStream, error) {
+	return c.newRecord(w.Format(), w, opts)
+}
+
+// NewPullRecord creates a record stream that is read by calling Read
+// (or ReadFloat32, ReadInt16) instead of passing the data to a writer.
+// The format must be one of the constants defined in the proto package.
+//
+// Recorded data is stored in a buffer until it is read, see RecordReadBufferSize and RecordOverflowPolicy.
+func (c *Client) NewPullRecord(format byte, opts ...RecordOption) (*RecordStream, error) {
+	check(format)
+	return c.newRecord(format, nil, opts)
+}
+
+func (c *Client) newRecord(format byte, w Writer, opts []RecordOption) (*RecordStream, error) {
 	r := &RecordStream{
 		c: c,
 		createRequest: proto.CreateRecordStream{
 			SourceIndex:        proto.Undefined,
 			ChannelMap:         proto.ChannelMap{proto.ChannelMono},
-			SampleSpec:         proto.SampleSpec{Format: w.Format(), Channels: 1, Rate: 44100},
+			SampleSpec:         proto.SampleSpec{Format: format, Channels: 1, Rate: 44100},
 			BufferMaxLength:    proto.Undefined,
 			Corked:             true,
 			BufferFragSize:     proto.Undefined,
 			DirectOnInputIndex: proto.Undefined,
 			Properties:         proto.PropList{},
 		},
-		bytesPerSample: bytes(w.Format()),
+		bytesPerSample: bytes(format),
 		w:              w,
 	}
+	r.state = newStateMachine(func(from, to streamState) {
+		c.logStateChange("record", r.index, from, to)
+	})
+	r.pullCond = sync.NewCond(&r.pullLock)
 
 	for _, opt := range opts {
 		opt(r)
@@ -51,70 +94,418 @@ func (c *Client) NewRecord(w Writer, opts ...RecordOption) (*RecordStream, error
 		r.createRequest.ChannelVolumes = cvol
 	}
 
-	err := c.c.Request(&r.createRequest, &r.createReply)
+	// Streams that record a single sink input must use the monitor of the sink input's sink.
+	if r.createRequest.DirectOnInputIndex != proto.Undefined &&
+		r.createRequest.SourceIndex == proto.Undefined && r.createRequest.SourceName == "" {
+		monitor, err := c.sinkInputMonitor(r.createRequest.DirectOnInputIndex)
+		if err != nil {
+			return nil, err
+		}
+		r.createRequest.SourceIndex = monitor
+	}
+
+	// Listen for changes in the source output if the application wants to be
+	// notified of volume changes.
+	if r.volumeChanges != nil || r.muteChanges != nil {
+		r.events = make(chan struct{}, 1)
+	}
+
+	err := c.request(&r.createRequest, &r.createReply)
 	if err != nil {
+		if c.isClosed() {
+			// The connection was closed while the stream was being created.
+			return nil, ErrClientClosed
+		}
 		return nil, err
 	}
 	r.index = r.createReply.StreamIndex
+	if w == nil {
+		r.ring = newRingBuffer(r.ringCapacity())
+	}
 	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		// The server removes the stream when the connection is closed.
+		return nil, ErrClientClosed
+	}
 	c.record[r.index] = r
+	// The goroutine is started while holding the lock, so that Close waits for it.
+	if r.events != nil {
+		events := r.events
+		c.goroutine(func() { r.handleEvents(events) })
+	}
 	c.mu.Unlock()
 	return r, nil
 }
 
 func (r *RecordStream) write(buf []byte) {
-	if r.err != nil {
+	if r.w == nil {
+		r.pullLock.Lock()
+		over := len(buf) - r.ring.free()
+		overflow := over > 0
+		if overflow {
+			r.overflowed = true
+			if r.overflowPolicy == OverflowDropOldest {
+				// Keep the buffer aligned to whole frames.
+				frame := r.bytesPerSample * int(r.createReply.Channels)
+				over += (frame - over%frame) % frame
+				if over > r.ring.len {
+					over = r.ring.len
+				}
+				r.ring.discard(over)
+			}
+		}
+		if r.overflowPolicy == OverflowDropOldest || len(buf) <= r.ring.free() {
+			r.ring.write(buf)
+		}
+		r.pullLock.Unlock()
+		r.pullCond.Broadcast()
+		if overflow {
+			r.bufferOverflow()
+		}
 		return
 	}
+	if r.err.get() != nil {
+		return
+	}
+	var start time.Time
+	if r.observer != nil {
+		start = time.Now()
+	}
 	_, err := r.w.Write(buf)
+	if r.observer != nil {
+		r.observer.CallbackDone(r.index, time.Since(start))
+	}
 	if err != nil {
-		r.err = err
-		go r.Stop()
+		r.err.set(err)
+		// Stopping sends a request, this must not block the client's read loop.
+		r.c.goroutine(func() { r.Stop() })
 	}
 }
 
 // Start starts recording audio.
-func (r *RecordStream) Start() {
-	if r.state == idle {
-		r.err = nil
-		r.c.c.Request(&proto.FlushRecordStream{StreamIndex: r.index}, nil)
-		r.c.c.Request(&proto.CorkRecordStream{StreamIndex: r.index, Corked: false}, nil)
-		r.state = running
+func (r *RecordStream) Start() error {
+	r.state.ops.Lock()
+	defer r.state.ops.Unlock()
+	if r.state.is(idle) {
+		r.err.set(nil)
+		r.overflows.reset()
+		err := r.c.request(&proto.FlushRecordStream{StreamIndex: r.index}, nil)
+		if err != nil {
+			return err
+		}
+		err = r.c.request(&proto.CorkRecordStream{StreamIndex: r.index, Corked: false}, nil)
+		if err != nil {
+			return err
+		}
+		r.state.setIf(running, idle)
 	}
+	return nil
 }
 
 // Stop stops recording audio; the callback will no longer be called.
-func (r *RecordStream) Stop() {
-	if r.state == running {
-		r.c.c.Request(&proto.CorkRecordStream{StreamIndex: r.index, Corked: true}, nil)
-		r.state = idle
+func (r *RecordStream) Stop() error {
+	r.state.ops.Lock()
+	defer r.state.ops.Unlock()
+	if r.state.is(running) {
+		err := r.c.request(&proto.CorkRecordStream{StreamIndex: r.index, Corked: true}, nil)
+		if err != nil {
+			return err
+		}
 	}
+	r.state.setIf(idle, running, paused)
+	return nil
+}
+
+// Pause stops recording audio without discarding the data buffered by the server.
+// Unlike Stop, recording continues with the buffered data when the stream is resumed.
+func (r *RecordStream) Pause() error {
+	r.state.ops.Lock()
+	defer r.state.ops.Unlock()
+	if r.state.is(running) {
+		err := r.c.request(&proto.CorkRecordStream{StreamIndex: r.index, Corked: true}, nil)
+		if err != nil {
+			return err
+		}
+		r.state.setIf(paused, running)
+	}
+	return nil
+}
+
+// Resume resumes a paused stream.
+func (r *RecordStream) Resume() error {
+	r.state.ops.Lock()
+	defer r.state.ops.Unlock()
+	if r.state.is(paused) {
+		err := r.c.request(&proto.CorkRecordStream{StreamIndex: r.index, Corked: false}, nil)
+		if err != nil {
+			return err
+		}
+		r.state.setIf(running, paused)
+	}
+	return nil
 }
 
 // Close closes the stream.
-func (r *RecordStream) Close() {
-	if !r.Closed() {
-		r.c.c.Request(&proto.DeleteRecordStream{StreamIndex: r.index}, nil)
-		r.state = closed
-		r.c.mu.Lock()
-		delete(r.c.record, r.index)
-		r.c.mu.Unlock()
+// The stream is closed even if the server returns an error.
+func (r *RecordStream) Close() error {
+	// Only one of Close, killed and a lost connection releases the stream.
+	if !r.state.setIfNot(closed, closed, serverLost, killed) {
+		return nil
+	}
+	err := r.c.deleteStream(&proto.DeleteRecordStream{StreamIndex: r.index})
+	r.c.mu.Lock()
+	delete(r.c.record, r.index)
+	r.c.mu.Unlock()
+	r.release()
+	return err
+}
+
+// release unblocks waiting calls after the stream was closed.
+// It must only be called by the caller that changed the state to closed, serverLost or killed.
+func (r *RecordStream) release() {
+	r.wakeReaders()
+
+	r.eventsLock.Lock()
+	if r.events != nil {
+		close(r.events)
+		r.events = nil
 	}
+	if r.streamEvents != nil {
+		close(r.streamEvents)
+		r.streamEvents = nil
+	}
+	r.eventsLock.Unlock()
+	r.overflows.close()
+}
+
+// Handle events for this record stream in a goroutine.
+// Event notifications are received through the events channel.
+func (r *RecordStream) handleEvents(events chan struct{}) {
+	volume := make(proto.ChannelVolumes, len(r.createRequest.ChannelMap))
+	muted := r.createRequest.MutedSet && r.createRequest.Muted
+
+	for range events {
+		// Something about our source output changed, so read the source output information.
+		reply := proto.GetSourceOutputInfoReply{}
+		err := r.c.request(&proto.GetSourceOutputInfo{
+			SourceOutpuIndex: r.createReply.SourceOutputIndex,
+		}, &reply)
+		if err != nil {
+			if r.Closed() {
+				break
+			}
+			if r.c.logger != nil {
+				r.c.logger.Log(proto.LevelWarn, "pulse: could not query source output", "index", r.createReply.SourceOutputIndex, "error", err)
+			}
+			continue
+		}
+
+		volumeChanged := false
+		for i, val := range reply.ChannelVolumes {
+			if volume[i] != val {
+				volume[i] = val
+				volumeChanged = true
+			}
+		}
+		if volumeChanged && r.volumeChanges != nil {
+			sendVolume(r.volumeChanges, append(proto.ChannelVolumes(nil), volume...)) // copy volume
+		}
+		if reply.Muted != muted {
+			muted = reply.Muted
+			if r.muteChanges != nil {
+				sendMute(r.muteChanges, muted)
+			}
+		}
+	}
+
+	// Record stream was closed, so close the channels.
+	if r.volumeChanges != nil {
+		close(r.volumeChanges)
+	}
+	if r.muteChanges != nil {
+		close(r.muteChanges)
+	}
+}
+
+// Volume returns the volume of each channel in the recording.
+func (r *RecordStream) Volume() (proto.ChannelVolumes, error) {
+	reply := proto.GetSourceOutputInfoReply{}
+	err := r.c.request(&proto.GetSourceOutputInfo{
+		SourceOutpuIndex: r.createReply.SourceOutputIndex,
+	}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.ChannelVolumes, nil
+}
+
+// SetVolume changes the volume of each channel in the recording.
+// See (*PlaybackStream).SetVolume for when the volume should be changed.
+func (r *RecordStream) SetVolume(volumes proto.ChannelVolumes) error {
+	return r.c.request(&proto.SetSourceOutputVolume{
+		SourceOutputIndex: r.createReply.SourceOutputIndex,
+		ChannelVolumes:    volumes,
+	}, nil)
+}
+
+// Mute returns wether the recording is muted.
+func (r *RecordStream) Mute() (bool, error) {
+	reply := proto.GetSourceOutputInfoReply{}
+	err := r.c.request(&proto.GetSourceOutputInfo{
+		SourceOutpuIndex: r.createReply.SourceOutputIndex,
+	}, &reply)
+	if err != nil {
+		return false, err
+	}
+	return reply.Muted, nil
+}
+
+// SetMute mutes or unmutes the recording.
+func (r *RecordStream) SetMute(mute bool) error {
+	return r.c.request(&proto.SetSourceOutputMute{
+		SourceOutputIndex: r.createReply.SourceOutputIndex,
+		Mute:              mute,
+	}, nil)
+}
+
+// MoveTo moves the stream to a different source while it is recording.
+// The server fails to move streams that were created with RecordNoMove.
+// Like moves by other clients, this is also reported as a StreamMoved event.
+func (r *RecordStream) MoveTo(source *Source) error {
+	err := r.c.request(&proto.MoveSourceOutput{
+		SourceOutputIndex: r.createReply.SourceOutputIndex,
+		DeviceIndex:       source.info.SourceIndex,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	reply := proto.GetSourceOutputInfoReply{}
+	err = r.c.request(&proto.GetSourceOutputInfo{
+		SourceOutpuIndex: r.createReply.SourceOutputIndex,
+	}, &reply)
+	if err != nil {
+		return err
+	}
+	r.bufferLock.Lock()
+	r.createReply.SourceIndex = reply.SourceIndex
+	r.createReply.SourceName = source.info.SourceName
+	r.createReply.SourceLatency = reply.SourceLatency
+	r.bufferLock.Unlock()
+	atomic.StoreUint32(&r.createReply.Rate, reply.Rate)
+	return nil
+}
+
+// Read reads recorded audio data from a stream created with NewPullRecord.
+// Read blocks until data is available, it returns io.EOF after the stream was closed and all buffered data was read.
+//
+// If the buffer overflowed since the last call to Read, Read returns ErrOverflow if the overflow policy is OverflowError.
+// With the default policy OverflowDropOldest, overflows are not reported by Read.
+func (r *RecordStream) Read(buf []byte) (int, error) {
+	return r.read(buf, 1)
+}
+
+// ReadFloat32 is like Read, but reads float32 samples.
+// It returns the number of samples read. The stream must use the native float32 format.
+func (r *RecordStream) ReadFloat32(buf []float32) (int, error) {
+	if r.createRequest.Format != formatF32 {
+		return 0, ErrWrongFormat
+	}
+	n, err := r.read(float32Bytes(buf), 4)
+	return n / 4, err
+}
+
+// ReadInt16 is like Read, but reads int16 samples.
+// It returns the number of samples read. The stream must use the native int16 format.
+func (r *RecordStream) ReadInt16(buf []int16) (int, error) {
+	if r.createRequest.Format != formatI16 {
+		return 0, ErrWrongFormat
+	}
+	n, err := r.read(int16Bytes(buf), 2)
+	return n / 2, err
+}
+
+func (r *RecordStream) read(buf []byte, align int) (int, error) {
+	if r.w != nil {
+		return 0, ErrPushStream
+	}
+	if len(buf) < align {
+		return 0, nil
+	}
+	r.pullLock.Lock()
+	defer r.pullLock.Unlock()
+	for r.ring.len < align && !r.overflowed && !r.Closed() {
+		r.pullCond.Wait()
+	}
+	if r.overflowed && r.overflowPolicy == OverflowError {
+		r.overflowed = false
+		return 0, ErrOverflow
+	}
+	r.overflowed = false
+	if r.ring.len < align {
+		if err := r.err.get(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	n := len(buf)
+	if n > r.ring.len {
+		n = r.ring.len
+	}
+	n -= n % align
+	return r.ring.read(buf[:n]), nil
+}
+
+// Readable returns the number of bytes that can currently be read without blocking.
+// It always returns 0 for streams that are not created with NewPullRecord.
+func (r *RecordStream) Readable() int {
+	if r.w != nil {
+		return 0
+	}
+	r.pullLock.Lock()
+	defer r.pullLock.Unlock()
+	return r.ring.len
+}
+
+// wakeReaders unblocks calls to Read after the stream was closed.
+func (r *RecordStream) wakeReaders() {
+	r.pullLock.Lock()
+	r.pullLock.Unlock()
+	r.pullCond.Broadcast()
 }
 
 // Closed returns wether the stream was closed.
+// This includes streams that were closed by the server, see StreamKilled.
 // Calling other methods on a closed stream may panic.
-func (r *RecordStream) Closed() bool { return r.state == closed || r.state == serverLost }
+func (r *RecordStream) Closed() bool {
+	return r.state.is(closed, serverLost, killed)
+}
 
 // Running returns wether the stream is currently recording.
-func (r *RecordStream) Running() bool { return r.state == running }
+func (r *RecordStream) Running() bool { return r.state.is(running) }
 
 // Error returns the last error returned by the stream's writer.
-func (r *RecordStream) Error() error { return r.err }
+func (r *RecordStream) Error() error { return r.err.get() }
 
 // SampleRate returns the stream's sample rate (samples per second).
 func (r *RecordStream) SampleRate() int {
-	return int(r.createReply.Rate)
+	return int(r.rate())
+}
+
+// SetSampleRate changes the sample rate of a stream that is already running.
+// The stream must be created with the RecordVariableRate option.
+func (r *RecordStream) SetSampleRate(rate int) error {
+	err := r.c.request(&proto.UpdateRecordStreamSampleRate{StreamIndex: r.index, SampleRate: uint32(rate)}, nil)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32(&r.createReply.Rate, uint32(rate))
+	return nil
+}
+
+// rate returns the current sample rate, which can be changed by SetSampleRate.
+func (r *RecordStream) rate() uint32 {
+	return atomic.LoadUint32(&r.createReply.Rate)
 }
 
 // Channels returns the number of channels.
@@ -128,6 +519,29 @@ func (r *RecordStream) StreamIndex() uint32 {
 	return r.index
 }
 
+// SourceIndex returns the index of the source the stream is connected to.
+// This changes when the stream is moved to a different source.
+func (r *RecordStream) SourceIndex() uint32 {
+	r.bufferLock.Lock()
+	defer r.bufferLock.Unlock()
+	return r.createReply.SourceIndex
+}
+
+// SourceName returns the name of the source the stream is connected to, this is the same as the source's ID.
+// This changes when the stream is moved to a different source.
+func (r *RecordStream) SourceName() string {
+	r.bufferLock.Lock()
+	defer r.bufferLock.Unlock()
+	return r.createReply.SourceName
+}
+
+// Suspended returns wether the source the stream is connected to is suspended.
+func (r *RecordStream) Suspended() bool {
+	r.bufferLock.Lock()
+	defer r.bufferLock.Unlock()
+	return r.createReply.SourceSuspended
+}
+
 // A RecordOption supplies configuration when creating streams.
 type RecordOption func(*RecordStream)
 
@@ -185,6 +599,11 @@ func RecordLatency(seconds float64) RecordOption {
 	}
 }
 
+// RecordVariableRate allows changing the sample rate of the stream with SetSampleRate.
+var RecordVariableRate RecordOption = func(r *RecordStream) {
+	r.createRequest.VariableRate = true
+}
+
 // RecordSource sets the source the stream should receive audio from.
 func RecordSource(source *Source) RecordOption {
 	return func(r *RecordStream) {
@@ -199,6 +618,22 @@ func RecordMonitor(sink *Sink) RecordOption {
 	}
 }
 
+// RecordNoMove prevents the stream from being moved to a different source,
+// neither by the server nor by the user or other clients.
+var RecordNoMove RecordOption = func(r *RecordStream) {
+	r.createRequest.NoMove = true
+}
+
+// RecordSinkInput records only the audio of a single playback stream, which may belong to any application.
+// The stream records from the monitor of the sink the sink input is connected to.
+// If the sink input is moved to a different sink or removed, the server kills the record stream, see StreamKilled.
+// See (*Client).SinkInputsByApplication and (*Client).SinkInputsByProcess.
+func RecordSinkInput(index uint32) RecordOption {
+	return func(r *RecordStream) {
+		r.createRequest.DirectOnInputIndex = index
+	}
+}
+
 // RecordMediaName sets the streams media name.
 // This will e.g. be displayed by a volume control application to identity the stream.
 func RecordMediaName(name string) RecordOption {
@@ -215,6 +650,100 @@ func RecordMediaIconName(name string) RecordOption {
 	}
 }
 
+// RecordVolumeChanges sets a channel to receive volume changes on, like PlaybackVolumeChanges.
+//
+// The channel should be buffered (1 element is sufficient). It will be closed
+// when the stream is closed.
+func RecordVolumeChanges(changes chan proto.ChannelVolumes) RecordOption {
+	return func(r *RecordStream) {
+		r.volumeChanges = changes
+	}
+}
+
+// RecordMuteChanges sets a channel to receive mute changes on, like PlaybackMuteChanges.
+//
+// The channel should be buffered (1 element is sufficient). It will be closed
+// when the stream is closed.
+func RecordMuteChanges(changes chan bool) RecordOption {
+	return func(r *RecordStream) {
+		r.muteChanges = changes
+	}
+}
+
+// RecordVolume sets the initial volume of each channel.
+// Usually the server should choose the volume, see (*PlaybackStream).SetVolume.
+func RecordVolume(volumes proto.ChannelVolumes) RecordOption {
+	return func(r *RecordStream) {
+		r.createRequest.ChannelVolumes = volumes
+		r.createRequest.VolumeSet = true
+	}
+}
+
+// RecordRelativeVolume makes the volume set with RecordVolume relative to the source's volume.
+// This only has an effect if the source uses flat volumes.
+var RecordRelativeVolume RecordOption = func(r *RecordStream) {
+	r.createRequest.RelativeVolume = true
+}
+
+// RecordMuted sets whether the stream is initially muted.
+// Without this option, the server decides, e.g. by restoring the state of an earlier stream of the application.
+func RecordMuted(muted bool) RecordOption {
+	return func(r *RecordStream) {
+		r.createRequest.Muted = muted
+		r.createRequest.MutedSet = true
+	}
+}
+
+// RecordEvents sets a channel to receive events that are caused by the server or other clients,
+// e.g. when the user moves the stream to a different source.
+//
+// The channel should be buffered, events are dropped if the channel is full.
+// It will be closed when the stream is closed.
+func RecordEvents(events chan<- StreamEvent) RecordOption {
+	return func(r *RecordStream) {
+		r.streamEvents = events
+	}
+}
+
+// RecordObserver sets an observer that is notified of overflows of the read buffer and of the time spent in the writer.
+// See ClientObserver for measuring the amount of data received.
+func RecordObserver(o StreamObserver) RecordOption {
+	return func(r *RecordStream) {
+		r.observer = o
+	}
+}
+
+// An OverflowPolicy determines what happens when the buffer of a stream created with NewPullRecord is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest data in the buffer to make room for new data.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowError discards new data and causes the next call to Read to return ErrOverflow.
+	OverflowError
+)
+
+// RecordReadBufferSize sets the size in bytes of the buffer that holds recorded data until it is read.
+// This only applies to streams created with NewPullRecord, the default is one second of audio.
+// The default size is enlarged if it can not hold a whole fragment,
+// other sizes are rounded up to whole frames.
+func RecordReadBufferSize(size int) RecordOption {
+	if size < 0 {
+		panic("pulse: invalid buffer size")
+	}
+	return func(r *RecordStream) {
+		r.ringSize = size
+	}
+}
+
+// RecordOverflowPolicy sets what happens if data is recorded faster than it is read.
+// This only applies to streams created with NewPullRecord, the default is OverflowDropOldest.
+func RecordOverflowPolicy(policy OverflowPolicy) RecordOption {
+	return func(r *RecordStream) {
+		r.overflowPolicy = policy
+	}
+}
+
 // RecordRawOption can be used to create custom options.
 //
 // This is an advanced function, similar to (*Client).RawRequest.
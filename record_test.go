@@ -0,0 +1,133 @@
+package pulse
+
+import (
+	"io"
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestRecordRead(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatInt16LE, RecordStereo, RecordReadBufferSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.conns[0].sendData(r.StreamIndex(), []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	buf := make([]byte, 3)
+	if n, err := r.Read(buf); n != 3 || err != nil || string(buf) != "\x01\x02\x03" {
+		t.Errorf("Read returned %d, %v, %v", n, err, buf)
+	}
+
+	// Overflow drops the oldest data.
+	s.conns[0].sendData(r.StreamIndex(), []byte{9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24})
+	waitFor(t, func() bool { return r.Readable() == 16 })
+	samples := make([]int16, 10)
+	n, err := r.ReadInt16(samples)
+	if n != 8 || err != nil || samples[0] != 0x0a09 {
+		t.Errorf("ReadInt16 returned %d, %v, %x", n, err, samples[:n])
+	}
+
+	r.Close()
+	if _, err := r.Read(buf); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestRecordReadOverflowError(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatUint8, RecordReadBufferSize(4), RecordOverflowPolicy(OverflowError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conns[0].sendData(r.StreamIndex(), []byte{1, 2, 3})
+	s.conns[0].sendData(r.StreamIndex(), []byte{4, 5})
+	waitFor(t, func() bool { return r.Readable() == 3 })
+	buf := make([]byte, 4)
+	if _, err := r.Read(buf); err != ErrOverflow {
+		t.Errorf("expected ErrOverflow, got %v", err)
+	}
+	if n, err := r.Read(buf); n != 3 || err != nil {
+		t.Errorf("Read returned %d, %v", n, err)
+	}
+}
+
+func TestRecordReadSmallBuffer(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	// The buffer is rounded up to one frame.
+	r, err := c.NewPullRecord(proto.FormatInt16LE, RecordStereo, RecordReadBufferSize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conns[0].sendData(r.StreamIndex(), []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	waitFor(t, func() bool { return r.Readable() == 4 })
+	buf := make([]byte, 8)
+	if n, err := r.Read(buf); n != 4 || err != nil || string(buf[:n]) != "\x05\x06\x07\x08" {
+		t.Errorf("Read returned %d, %v, %v", n, err, buf[:n])
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("negative size did not panic")
+		}
+	}()
+	RecordReadBufferSize(-1)
+}
+
+func TestRecordPause(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatUint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pause(); err != nil || s.received(proto.OpCorkRecordStream) != 0 {
+		t.Errorf("pausing a stopped stream: %v", err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Running() || s.received(proto.OpCorkRecordStream) != 2 {
+		t.Error("stream was not paused")
+	}
+	// Start does not resume a paused stream, the buffered data would be discarded.
+	if err := r.Start(); err != nil || r.Running() {
+		t.Errorf("Start resumed a paused stream: %v", err)
+	}
+	if err := r.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Running() || s.received(proto.OpCorkRecordStream) != 3 {
+		t.Error("stream was not resumed")
+	}
+
+	// A paused stream is already corked, stopping it does not send a request.
+	r.Pause()
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if s.received(proto.OpCorkRecordStream) != 4 || s.received(proto.OpFlushRecordStream) != 1 {
+		t.Errorf("%d cork and %d flush requests", s.received(proto.OpCorkRecordStream), s.received(proto.OpFlushRecordStream))
+	}
+	if err := r.Start(); err != nil || !r.Running() {
+		t.Errorf("stream was not restarted: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package pulse
+
+// ringBuffer is a fixed-size FIFO of bytes.
+type ringBuffer struct {
+	buf []byte
+	pos int // position of the first byte
+	len int // number of bytes stored
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, size)}
+}
+
+// free returns the number of bytes that can be written without overwriting data.
+func (b *ringBuffer) free() int { return len(b.buf) - b.len }
+
+// write appends p to the buffer. If there is not enough space, the oldest data is overwritten.
+// It returns the number of bytes that were discarded.
+func (b *ringBuffer) write(p []byte) (dropped int) {
+	if len(p) > len(b.buf) {
+		dropped = len(p) - len(b.buf)
+		p = p[dropped:]
+	}
+	if over := len(p) - b.free(); over > 0 {
+		b.discard(over)
+		dropped += over
+	}
+	end := (b.pos + b.len) % len(b.buf)
+	n := copy(b.buf[end:], p)
+	copy(b.buf, p[n:])
+	b.len += len(p)
+	return dropped
+}
+
+// read moves up to len(p) bytes from the buffer into p.
+func (b *ringBuffer) read(p []byte) int {
+	if len(p) > b.len {
+		p = p[:b.len]
+	}
+	n := copy(p, b.buf[b.pos:])
+	copy(p[n:], b.buf)
+	b.discard(len(p))
+	return len(p)
+}
+
+func (b *ringBuffer) discard(n int) {
+	b.pos = (b.pos + n) % len(b.buf)
+	b.len -= n
+}
+
+// resize changes the size of the buffer, keeping the newest data.
+func (b *ringBuffer) resize(size int) {
+	if size == len(b.buf) {
+		return
+	}
+	if b.len > size {
+		b.discard(b.len - size)
+	}
+	buf := make([]byte, size)
+	n := b.len
+	b.read(buf)
+	b.buf, b.pos, b.len = buf, 0, n
+}
@@ -0,0 +1,32 @@
+package pulse
+
+import "testing"
+
+func TestRingBuffer(t *testing.T) {
+	b := newRingBuffer(8)
+	if d := b.write([]byte{1, 2, 3, 4, 5, 6}); d != 0 {
+		t.Errorf("dropped %d bytes", d)
+	}
+	out := make([]byte, 4)
+	if n := b.read(out); n != 4 || string(out) != "\x01\x02\x03\x04" {
+		t.Errorf("read %v", out[:n])
+	}
+	// wraps around
+	if d := b.write([]byte{7, 8, 9, 10, 11}); d != 0 {
+		t.Errorf("dropped %d bytes", d)
+	}
+	// overwrites 5 and 6
+	if d := b.write([]byte{12, 13, 14}); d != 2 {
+		t.Errorf("expected 2 dropped bytes, got %d", d)
+	}
+	out = make([]byte, 10)
+	if n := b.read(out); n != 8 || string(out[:n]) != "\x07\x08\x09\x0a\x0b\x0c\x0d\x0e" {
+		t.Errorf("read %v", out[:n])
+	}
+
+	b.write([]byte{1, 2, 3, 4, 5, 6})
+	b.resize(4)
+	if n := b.read(out); n != 4 || string(out[:n]) != "\x03\x04\x05\x06" {
+		t.Errorf("read %v after resize", out[:n])
+	}
+}
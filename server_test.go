@@ -0,0 +1,494 @@
+package pulse
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// testServer is a minimal fake pulseaudio server.
+// It answers requests with plausible replies and records what it received.
+type testServer struct {
+	t    *testing.T
+	path string
+	l    net.Listener
+
+	// handle can be set to override the reply to a request.
+	// It should return false if the request was not handled.
+	handle func(c *serverConn, op, tag uint32, args []interface{}) bool
+
+	mu        sync.Mutex
+	conns     []*serverConn
+	ops       []uint32
+	data      map[uint32]int
+	syncIDs   map[uint32]uint32
+	nextIndex uint32
+}
+
+type serverConn struct {
+	s    *testServer
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{
+		t:       t,
+		path:    filepath.Join(t.TempDir(), "native"),
+		data:    make(map[uint32]int),
+		syncIDs: make(map[uint32]uint32),
+	}
+	var err error
+	s.l, err = net.Listen("unix", s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go s.accept(done)
+	t.Cleanup(func() {
+		s.l.Close()
+		<-done
+		s.mu.Lock()
+		for _, c := range s.conns {
+			c.conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	return s
+}
+
+// client connects a new client to the server.
+func (s *testServer) client(opts ...ClientOption) *Client {
+	c, err := NewClient(append([]ClientOption{ClientServerString(s.path)}, opts...)...)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return c
+}
+
+func (s *testServer) accept(done chan struct{}) {
+	defer close(done)
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		c := &serverConn{s: s, conn: conn}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// received returns how often a command was received.
+func (s *testServer) received(op uint32) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, o := range s.ops {
+		if o == op {
+			n++
+		}
+	}
+	return n
+}
+
+// dataReceived returns how many bytes of audio data were received for a stream.
+func (s *testServer) dataReceived(index uint32) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[index]
+}
+
+// send sends a message to all connected clients.
+func (s *testServer) send(op uint32, t *tags) {
+	s.mu.Lock()
+	conns := append([]*serverConn(nil), s.conns...)
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.send(op, t)
+	}
+}
+
+func (c *serverConn) serve() {
+	var desc [20]byte
+	for {
+		if _, err := io.ReadFull(c.conn, desc[:]); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint32(desc[0:])
+		index := binary.BigEndian.Uint32(desc[4:])
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.conn, payload); err != nil {
+			return
+		}
+		if index != 0xFFFFFFFF {
+			c.s.mu.Lock()
+			c.s.data[index] += len(payload)
+			c.s.mu.Unlock()
+			continue
+		}
+		args := parseTags(payload)
+		op, tag := args[0].(uint32), args[1].(uint32)
+		c.s.mu.Lock()
+		c.s.ops = append(c.s.ops, op)
+		handle := c.s.handle
+		c.s.mu.Unlock()
+		if handle == nil || !handle(c, op, tag, args[2:]) {
+			c.defaultReply(op, tag, args[2:])
+		}
+	}
+}
+
+func (c *serverConn) defaultReply(op, tag uint32, args []interface{}) {
+	switch op {
+	case proto.OpAuth:
+		c.reply(tag, new(tags).u32(32))
+	case proto.OpSetClientName:
+		c.reply(tag, new(tags).u32(1))
+	case proto.OpCreatePlaybackStream:
+		spec := args[0].(proto.SampleSpec)
+		frame := uint32(bytes(spec.Format)) * uint32(spec.Channels)
+		maxLength, tlength, prebuf, minreq := args[4].(uint32), args[6].(uint32), args[7].(uint32), args[8].(uint32)
+		if tlength == proto.Undefined {
+			tlength = spec.Rate / 10 * frame
+		}
+		if maxLength == proto.Undefined {
+			maxLength = 4 * tlength
+		}
+		if prebuf == proto.Undefined {
+			prebuf = tlength
+		}
+		if minreq == proto.Undefined {
+			minreq = tlength / 4
+		}
+		// The first requested format is accepted.
+		encoding := byte(proto.EncodingPCM)
+		for i := len(args) - 1; i >= 0; i-- {
+			if f, ok := args[i].(proto.FormatInfo); ok {
+				encoding = f.Encoding
+			}
+		}
+		index := c.s.newIndex()
+		c.s.mu.Lock()
+		c.s.syncIDs[index] = args[9].(uint32)
+		c.s.mu.Unlock()
+		c.reply(tag, new(tags).
+			u32(index).u32(index).u32(tlength).
+			u32(maxLength).u32(tlength).u32(prebuf).u32(minreq).
+			spec(spec).channelMap(args[1].(proto.ChannelMap)).
+			u32(0).str("test-sink").boolean(false).
+			usec(10000).
+			format(encoding))
+	case proto.OpCreateRecordStream:
+		spec := args[0].(proto.SampleSpec)
+		frame := uint32(bytes(spec.Format)) * uint32(spec.Channels)
+		maxLength, fragSize := args[4].(uint32), args[6].(uint32)
+		if fragSize == proto.Undefined {
+			fragSize = spec.Rate / 50 * frame
+		}
+		if maxLength == proto.Undefined {
+			maxLength = 4 * fragSize
+		}
+		index := c.s.newIndex()
+		c.reply(tag, new(tags).
+			u32(index).u32(index).
+			u32(maxLength).u32(fragSize).
+			spec(spec).channelMap(args[1].(proto.ChannelMap)).
+			u32(0).str("test-source").boolean(false).
+			usec(10000).
+			format(proto.EncodingPCM))
+	case proto.OpCorkPlaybackStream:
+		c.reply(tag, new(tags))
+		if !args[1].(bool) {
+			// All streams with the same sync ID are started.
+			c.s.mu.Lock()
+			var started []uint32
+			for index, id := range c.s.syncIDs {
+				if id == c.s.syncIDs[args[0].(uint32)] {
+					started = append(started, index)
+				}
+			}
+			c.s.mu.Unlock()
+			for _, index := range started {
+				c.send(proto.OpStarted, new(tags).u32(index))
+			}
+		}
+	default:
+		c.reply(tag, new(tags))
+	}
+}
+
+func (s *testServer) newIndex() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextIndex++
+	return s.nextIndex
+}
+
+func (c *serverConn) reply(tag uint32, t *tags) {
+	c.packet(new(tags).u32(proto.OpReply).u32(tag).append(t))
+}
+
+func (c *serverConn) error(tag uint32, code proto.Error) {
+	c.packet(new(tags).u32(proto.OpError).u32(tag).u32(uint32(code)))
+}
+
+func (c *serverConn) send(op uint32, t *tags) {
+	c.packet(new(tags).u32(op).u32(0xFFFFFFFF).append(t))
+}
+
+// sendData sends audio data for a record stream.
+func (c *serverConn) sendData(index uint32, data []byte) {
+	c.write(index, data)
+}
+
+func (c *serverConn) packet(t *tags) {
+	c.write(0xFFFFFFFF, t.buf)
+}
+
+func (c *serverConn) write(index uint32, data []byte) {
+	var desc [20]byte
+	binary.BigEndian.PutUint32(desc[0:], uint32(len(data)))
+	binary.BigEndian.PutUint32(desc[4:], index)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write(desc[:])
+	c.conn.Write(data)
+}
+
+// sinkInputInfo builds a reply to GetSinkInputInfo.
+func sinkInputInfo(index, sink uint32, volume proto.ChannelVolumes, muted bool) *tags {
+	return sinkInputInfoProps(index, sink, volume, muted, proto.PropList{})
+}
+
+// sinkInputInfoProps builds a reply to GetSinkInputInfo with properties.
+func sinkInputInfoProps(index, sink uint32, volume proto.ChannelVolumes, muted bool, props proto.PropList) *tags {
+	m := make(proto.ChannelMap, len(volume))
+	return new(tags).
+		u32(index).str("test").u32(0).u32(0).u32(sink).
+		spec(proto.SampleSpec{Format: proto.FormatInt16LE, Channels: byte(len(volume)), Rate: 44100}).
+		channelMap(m).volumes(volume).
+		usec(0).usec(20000).str("").str("").
+		boolean(muted).propList(props).boolean(false).boolean(true).boolean(true).
+		format(proto.EncodingPCM)
+}
+
+// sourceOutputInfo builds a reply to GetSourceOutputInfo.
+func sourceOutputInfo(index, source uint32, volume proto.ChannelVolumes, muted bool) *tags {
+	m := make(proto.ChannelMap, len(volume))
+	return new(tags).
+		u32(index).str("test").u32(0).u32(0).u32(source).
+		spec(proto.SampleSpec{Format: proto.FormatInt16LE, Channels: byte(len(volume)), Rate: 44100}).
+		channelMap(m).
+		usec(0).usec(20000).str("").str("").
+		propList(proto.PropList{}).boolean(false).
+		volumes(volume).boolean(muted).boolean(true).boolean(true).
+		format(proto.EncodingPCM)
+}
+
+// sinkInfo builds a reply to GetSinkInfo.
+func sinkInfo(index, monitor uint32) *tags {
+	return new(tags).
+		u32(index).str("test-sink").str("Test Sink").
+		spec(proto.SampleSpec{Format: proto.FormatInt16LE, Channels: 2, Rate: 44100}).
+		channelMap(proto.ChannelMap{proto.ChannelLeft, proto.ChannelRight}).u32(0).
+		volumes(proto.ChannelVolumes{proto.VolumeNorm, proto.VolumeNorm}).boolean(false).
+		u32(monitor).str("test-sink.monitor").usec(0).str("").u32(0).
+		propList(proto.PropList{}).usec(0).
+		volume(proto.VolumeNorm).u32(0).u32(0).u32(0).
+		u32(0).str("").
+		append(&tags{[]byte{'B', 1}}).format(proto.EncodingPCM)
+}
+
+// tags builds a tagstruct.
+type tags struct{ buf []byte }
+
+func (t *tags) u32(v uint32) *tags {
+	t.buf = append(t.buf, 'L', byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	return t
+}
+
+func (t *tags) u64(typ byte, v uint64) *tags {
+	t.buf = append(t.buf, typ)
+	t.buf = append(t.buf, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(t.buf[len(t.buf)-8:], v)
+	return t
+}
+
+func (t *tags) usec(v proto.Microseconds) *tags { return t.u64('U', uint64(v)) }
+func (t *tags) i64(v int64) *tags               { return t.u64('r', uint64(v)) }
+func (t *tags) u64r(v uint64) *tags             { return t.u64('R', v) }
+
+func (t *tags) time(v proto.Time) *tags {
+	s, us := v.Seconds, v.Microseconds
+	t.buf = append(t.buf, 'T', byte(s>>24), byte(s>>16), byte(s>>8), byte(s), byte(us>>24), byte(us>>16), byte(us>>8), byte(us))
+	return t
+}
+
+func (t *tags) boolean(v bool) *tags {
+	if v {
+		t.buf = append(t.buf, '1')
+	} else {
+		t.buf = append(t.buf, '0')
+	}
+	return t
+}
+
+func (t *tags) str(s string) *tags {
+	if s == "" {
+		t.buf = append(t.buf, 'N')
+		return t
+	}
+	t.buf = append(t.buf, 't')
+	t.buf = append(t.buf, s...)
+	t.buf = append(t.buf, 0)
+	return t
+}
+
+func (t *tags) spec(s proto.SampleSpec) *tags {
+	t.buf = append(t.buf, 'a', s.Format, s.Channels, byte(s.Rate>>24), byte(s.Rate>>16), byte(s.Rate>>8), byte(s.Rate))
+	return t
+}
+
+func (t *tags) channelMap(m proto.ChannelMap) *tags {
+	t.buf = append(t.buf, 'm', byte(len(m)))
+	t.buf = append(t.buf, m...)
+	return t
+}
+
+func (t *tags) volume(v proto.Volume) *tags {
+	t.buf = append(t.buf, 'V', byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	return t
+}
+
+func (t *tags) volumes(v proto.ChannelVolumes) *tags {
+	t.buf = append(t.buf, 'v', byte(len(v)))
+	for _, v := range v {
+		t.buf = append(t.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return t
+}
+
+func (t *tags) propList(p proto.PropList) *tags {
+	t.buf = append(t.buf, 'P')
+	for k, v := range p {
+		t.str(k)
+		t.u32(uint32(len(v)))
+		t.buf = append(t.buf, 'x', byte(len(v)>>24), byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+		t.buf = append(t.buf, v...)
+	}
+	t.buf = append(t.buf, 'N')
+	return t
+}
+
+func (t *tags) format(encoding byte) *tags {
+	t.buf = append(t.buf, 'f', 'B', encoding, 'P', 'N')
+	return t
+}
+
+func (t *tags) append(u *tags) *tags {
+	t.buf = append(t.buf, u.buf...)
+	return t
+}
+
+// parseTags decodes a tagstruct into a list of values.
+// Property lists are skipped and appear as nil, formats appear without their properties.
+func parseTags(b []byte) []interface{} {
+	var values []interface{}
+	u32 := func() uint32 {
+		v := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		return v
+	}
+	for len(b) > 0 {
+		typ := b[0]
+		b = b[1:]
+		switch typ {
+		case 't':
+			end := strings.IndexByte(string(b), 0)
+			values = append(values, string(b[:end]))
+			b = b[end+1:]
+		case 'N':
+			values = append(values, "")
+		case 'L', 'V':
+			values = append(values, u32())
+		case 'B':
+			values = append(values, b[0])
+			b = b[1:]
+		case 'R', 'r', 'U':
+			values = append(values, binary.BigEndian.Uint64(b))
+			b = b[8:]
+		case 'a':
+			values = append(values, proto.SampleSpec{Format: b[0], Channels: b[1], Rate: binary.BigEndian.Uint32(b[2:])})
+			b = b[6:]
+		case 'x':
+			n := u32()
+			values = append(values, b[:n])
+			b = b[n:]
+		case '1':
+			values = append(values, true)
+		case '0':
+			values = append(values, false)
+		case 'T':
+			values = append(values, proto.Time{Seconds: binary.BigEndian.Uint32(b), Microseconds: binary.BigEndian.Uint32(b[4:])})
+			b = b[8:]
+		case 'm':
+			values = append(values, proto.ChannelMap(b[1:1+b[0]]))
+			b = b[1+b[0]:]
+		case 'v':
+			v := make(proto.ChannelVolumes, b[0])
+			b = b[1:]
+			for i := range v {
+				v[i] = proto.Volume(u32())
+			}
+			values = append(values, v)
+		case 'P', 'f':
+			var value interface{}
+			if typ == 'f' {
+				value = proto.FormatInfo{Encoding: b[1]}
+				b = b[3:] // encoding and 'P'
+			}
+			for b[0] != 'N' {
+				end := strings.IndexByte(string(b), 0)
+				b = b[end+1+5+1:] // key, length and 'x'
+				n := u32()
+				b = b[n:]
+			}
+			b = b[1:]
+			values = append(values, value)
+		default:
+			panic("unknown tag " + string(typ))
+		}
+	}
+	return values
+}
+
+// checkGoroutines fails the test if goroutines started by the library are still running.
+func checkGoroutines(t *testing.T) {
+	t.Helper()
+	var leaked []string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		leaked = nil
+		for _, g := range strings.Split(string(buf), "\n\n") {
+			if strings.Contains(g, "github.com/jfreymuth/pulse") && !strings.Contains(g, "_test.go") {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 {
+			return
+		}
+	}
+	t.Errorf("leaked goroutines:\n%s", strings.Join(leaked, "\n\n"))
+}
@@ -10,7 +10,7 @@ type Sink struct {
 // ListSinks returns a list of all available output devices.
 func (c *Client) ListSinks() ([]*Sink, error) {
 	var reply proto.GetSinkInfoListReply
-	err := c.c.Request(&proto.GetSinkInfoList{}, &reply)
+	err := c.request(&proto.GetSinkInfoList{}, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +24,7 @@ func (c *Client) ListSinks() ([]*Sink, error) {
 // DefaultSink returns the default output device.
 func (c *Client) DefaultSink() (*Sink, error) {
 	var sink Sink
-	err := c.c.Request(&proto.GetSinkInfo{SinkIndex: proto.Undefined}, &sink.info)
+	err := c.request(&proto.GetSinkInfo{SinkIndex: proto.Undefined}, &sink.info)
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +34,7 @@ func (c *Client) DefaultSink() (*Sink, error) {
 // SinkByID looks up a sink id.
 func (c *Client) SinkByID(name string) (*Sink, error) {
 	var sink Sink
-	err := c.c.Request(&proto.GetSinkInfo{SinkIndex: proto.Undefined, SinkName: name}, &sink.info)
+	err := c.request(&proto.GetSinkInfo{SinkIndex: proto.Undefined, SinkName: name}, &sink.info)
 	if err != nil {
 		return nil, err
 	}
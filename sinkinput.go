@@ -0,0 +1,101 @@
+package pulse
+
+import (
+	"strconv"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// A SinkInput is a playback stream of any client connected to the server.
+type SinkInput struct {
+	info proto.GetSinkInputInfoReply
+}
+
+// ListSinkInputs returns all playback streams of all clients.
+func (c *Client) ListSinkInputs() ([]*SinkInput, error) {
+	var reply proto.GetSinkInputInfoListReply
+	err := c.request(&proto.GetSinkInputInfoList{}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]*SinkInput, len(reply))
+	for i := range inputs {
+		inputs[i] = &SinkInput{info: *reply[i]}
+	}
+	return inputs, nil
+}
+
+// SinkInputsByApplication returns the playback streams of all clients with the given application name,
+// see (*SinkInput).ApplicationName.
+func (c *Client) SinkInputsByApplication(name string) ([]*SinkInput, error) {
+	return c.findSinkInputs(func(s *SinkInput) bool { return s.ApplicationName() == name })
+}
+
+// SinkInputsByProcess returns the playback streams of all clients running in the process with the given ID.
+func (c *Client) SinkInputsByProcess(pid int) ([]*SinkInput, error) {
+	return c.findSinkInputs(func(s *SinkInput) bool { return s.ProcessID() == pid })
+}
+
+func (c *Client) findSinkInputs(match func(*SinkInput) bool) ([]*SinkInput, error) {
+	inputs, err := c.ListSinkInputs()
+	if err != nil {
+		return nil, err
+	}
+	var found []*SinkInput
+	for _, s := range inputs {
+		if match(s) {
+			found = append(found, s)
+		}
+	}
+	return found, nil
+}
+
+// sinkInputMonitor returns the index of the monitor source of the sink a sink input is connected to.
+func (c *Client) sinkInputMonitor(sinkInput uint32) (uint32, error) {
+	var input proto.GetSinkInputInfoReply
+	err := c.request(&proto.GetSinkInputInfo{SinkInputIndex: sinkInput}, &input)
+	if err != nil {
+		return 0, err
+	}
+	var sink proto.GetSinkInfoReply
+	err = c.request(&proto.GetSinkInfo{SinkIndex: input.SinkIndex}, &sink)
+	if err != nil {
+		return 0, err
+	}
+	return sink.MonitorSourceIndex, nil
+}
+
+// SinkInputIndex returns the sink input index, which can be used with RecordSinkInput.
+func (s *SinkInput) SinkInputIndex() uint32 {
+	return s.info.SinkInputIndex
+}
+
+// SinkIndex returns the index of the sink the stream plays to.
+func (s *SinkInput) SinkIndex() uint32 {
+	return s.info.SinkIndex
+}
+
+// Name returns the stream's media name, e.g. the title of a song or a browser tab.
+func (s *SinkInput) Name() string {
+	return s.info.MediaName
+}
+
+// ApplicationName returns the name of the application that created the stream,
+// as set by the application with ClientApplicationName or a similar function of other client libraries.
+func (s *SinkInput) ApplicationName() string {
+	return s.property("application.name")
+}
+
+// ProcessID returns the ID of the process that created the stream, or 0 if it is not known.
+func (s *SinkInput) ProcessID() int {
+	pid, _ := strconv.Atoi(s.property("application.process.id"))
+	return pid
+}
+
+func (s *SinkInput) property(key string) string {
+	e, ok := s.info.Properties[key]
+	if !ok || len(e) == 0 || e[len(e)-1] != 0 {
+		return ""
+	}
+	return string(e[:len(e)-1])
+}
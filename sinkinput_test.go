@@ -0,0 +1,91 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestSinkInputs(t *testing.T) {
+	s := newTestServer(t)
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		if op != proto.OpGetSinkInputInfoList {
+			return false
+		}
+		vol := proto.ChannelVolumes{proto.VolumeNorm}
+		c.reply(tag, new(tags).
+			append(sinkInputInfoProps(1, 0, vol, false, proto.PropList{
+				"application.name":       proto.PropListString("firefox"),
+				"application.process.id": proto.PropListString("100"),
+			})).
+			append(sinkInputInfoProps(2, 0, vol, false, proto.PropList{
+				"application.name":       proto.PropListString("mpv"),
+				"application.process.id": proto.PropListString("200"),
+			})).
+			append(sinkInputInfoProps(3, 0, vol, false, proto.PropList{
+				"application.name": proto.PropListString("firefox"),
+			})))
+		return true
+	}
+	c := s.client()
+	defer c.Close()
+
+	inputs, err := c.SinkInputsByApplication("firefox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 2 || inputs[0].SinkInputIndex() != 1 || inputs[1].SinkInputIndex() != 3 {
+		t.Errorf("unexpected sink inputs %v", inputs)
+	}
+	if inputs[0].ProcessID() != 100 || inputs[1].ProcessID() != 0 {
+		t.Errorf("unexpected process IDs %d, %d", inputs[0].ProcessID(), inputs[1].ProcessID())
+	}
+
+	inputs, err = c.SinkInputsByProcess(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 1 || inputs[0].ApplicationName() != "mpv" {
+		t.Errorf("unexpected sink inputs %v", inputs)
+	}
+}
+
+func TestRecordSinkInput(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpGetSinkInputInfo:
+			c.reply(tag, sinkInputInfo(a[0].(uint32), 3, proto.ChannelVolumes{proto.VolumeNorm}, false))
+			return true
+		case proto.OpGetSinkInfo:
+			c.reply(tag, sinkInfo(3, 4))
+			return true
+		case proto.OpCreateRecordStream:
+			args = a
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	r, err := c.NewPullRecord(proto.FormatInt16LE, RecordSinkInput(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if args[2].(uint32) != 4 || args[17].(uint32) != 12 {
+		t.Errorf("expected source 4 and sink input 12, got %v, %v", args[2], args[17])
+	}
+
+	// The source is not looked up if it is set explicitly.
+	source := &Source{info: proto.GetSourceInfoReply{SourceIndex: 5}}
+	r2, err := c.NewPullRecord(proto.FormatInt16LE, RecordSinkInput(12), RecordSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if args[2].(uint32) != 5 || s.received(proto.OpGetSinkInfo) != 1 {
+		t.Errorf("expected source 5 and one lookup, got %v, %d", args[2], s.received(proto.OpGetSinkInfo))
+	}
+}
@@ -10,7 +10,7 @@ type Source struct {
 // ListSources returns a list of all available input devices.
 func (c *Client) ListSources() ([]*Source, error) {
 	var reply proto.GetSourceInfoListReply
-	err := c.c.Request(&proto.GetSourceInfoList{}, &reply)
+	err := c.request(&proto.GetSourceInfoList{}, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +24,7 @@ func (c *Client) ListSources() ([]*Source, error) {
 // DefaultSource returns the default input device.
 func (c *Client) DefaultSource() (*Source, error) {
 	var source Source
-	err := c.c.Request(&proto.GetSourceInfo{SourceIndex: proto.Undefined}, &source.info)
+	err := c.request(&proto.GetSourceInfo{SourceIndex: proto.Undefined}, &source.info)
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +34,7 @@ func (c *Client) DefaultSource() (*Source, error) {
 // SourceByID looks up a source id.
 func (c *Client) SourceByID(name string) (*Source, error) {
 	var source Source
-	err := c.c.Request(&proto.GetSourceInfo{SourceIndex: proto.Undefined, SourceName: name}, &source.info)
+	err := c.request(&proto.GetSourceInfo{SourceIndex: proto.Undefined, SourceName: name}, &source.info)
 	if err != nil {
 		return nil, err
 	}
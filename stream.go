@@ -10,26 +10,87 @@ const (
 	paused
 	closed
 	serverLost
+	killed
 )
 
+func (s streamState) String() string {
+	switch s {
+	case idle:
+		return "idle"
+	case running:
+		return "running"
+	case paused:
+		return "paused"
+	case closed:
+		return "closed"
+	case serverLost:
+		return "server lost"
+	case killed:
+		return "killed"
+	}
+	return "invalid"
+}
+
 type stateMachine struct {
 	state streamState
 
 	lock *sync.RWMutex
+
+	// ops serializes Start, Stop, Pause and Resume, which send a request before changing the state.
+	// Close and the client's read loop don't take it, they only use setIf and setIfNot.
+	ops sync.Mutex
+
+	onChange func(from, to streamState)
 }
 
-func newStateMachine() *stateMachine {
+func newStateMachine(onChange func(from, to streamState)) *stateMachine {
 	return &stateMachine{
-		state: idle,
-		lock:  &sync.RWMutex{},
+		state:    idle,
+		lock:     &sync.RWMutex{},
+		onChange: onChange,
 	}
 }
 
-func (s *stateMachine) set(state streamState) {
+// setIf changes the state if the current state is one of from, and reports whether it was changed.
+func (s *stateMachine) setIf(state streamState, from ...streamState) bool {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	current := s.state
+	ok := false
+	for _, st := range from {
+		if current == st {
+			ok = true
+			break
+		}
+	}
+	if ok {
+		s.state = state
+	}
+	s.lock.Unlock()
+
+	if ok && s.onChange != nil {
+		s.onChange(current, state)
+	}
+	return ok
+}
 
+// setIfNot changes the state unless the current state is one of states, and reports whether it was changed.
+// Only one of several concurrent calls that move the stream to a final state succeeds.
+func (s *stateMachine) setIfNot(state streamState, states ...streamState) bool {
+	s.lock.Lock()
+	from := s.state
+	for _, st := range states {
+		if from == st {
+			s.lock.Unlock()
+			return false
+		}
+	}
 	s.state = state
+	s.lock.Unlock()
+
+	if s.onChange != nil {
+		s.onChange(from, state)
+	}
+	return true
 }
 
 func (s *stateMachine) get() streamState {
@@ -48,3 +109,21 @@ func (s *stateMachine) is(states ...streamState) bool {
 	}
 	return false
 }
+
+// streamError is the error that stopped a stream. It can be accessed concurrently.
+type streamError struct {
+	lock sync.Mutex
+	err  error
+}
+
+func (e *streamError) set(err error) {
+	e.lock.Lock()
+	e.err = err
+	e.lock.Unlock()
+}
+
+func (e *streamError) get() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.err
+}
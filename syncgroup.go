@@ -0,0 +1,84 @@
+package pulse
+
+import (
+	"sync"
+	"time"
+)
+
+// A SyncGroup links playback streams so that they play in sync.
+// The server starts and stops all streams of a group at the same sample,
+// this can e.g. be used to play separate stems of a song or separate streams for each speaker.
+//
+// All streams of a group must play to the same sink.
+// Starting, pausing or resuming any stream of the group affects all streams.
+type SyncGroup struct {
+	c  *Client
+	id uint32
+
+	mu      sync.Mutex
+	streams []*PlaybackStream
+}
+
+// NewSyncGroup creates a new, empty sync group.
+// Streams are added to the group by creating them with the PlaybackSyncGroup option.
+func (c *Client) NewSyncGroup() *SyncGroup {
+	return &SyncGroup{c: c, id: c.newSyncID()}
+}
+
+// PlaybackSyncGroup adds the stream to a sync group.
+// The stream will be played on the same sink as the other streams of the group.
+func PlaybackSyncGroup(g *SyncGroup) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.group = g
+		p.createRequest.SyncID = g.id
+	}
+}
+
+// Streams returns the streams of the group that have not been closed.
+func (g *SyncGroup) Streams() []*PlaybackStream {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*PlaybackStream(nil), g.streams...)
+}
+
+// Start starts all streams of the group that are not running.
+// The streams will start playing at the same time.
+func (g *SyncGroup) Start() error { return startPlayback(g.Streams(), 0) }
+
+// StartAt starts all streams of the group so that they are heard at the given time, see (*PlaybackStream).StartAt.
+func (g *SyncGroup) StartAt(t time.Time) (time.Duration, error) {
+	return startPlaybackAt(g.Streams(), t)
+}
+
+// Stop stops all streams of the group, see (*PlaybackStream).Stop.
+func (g *SyncGroup) Stop() {
+	for _, p := range g.Streams() {
+		p.Stop()
+	}
+}
+
+// StopNow stops all streams of the group immediately, see (*PlaybackStream).StopNow.
+func (g *SyncGroup) StopNow() error { return stopPlayback(g.Streams()) }
+
+// Pause pauses all streams of the group.
+func (g *SyncGroup) Pause() error { return corkPlayback(g.Streams(), true) }
+
+// Resume resumes all streams of the group.
+func (g *SyncGroup) Resume() error { return corkPlayback(g.Streams(), false) }
+
+func (g *SyncGroup) add(p *PlaybackStream) {
+	g.mu.Lock()
+	g.streams = append(g.streams, p)
+	g.mu.Unlock()
+}
+
+func (g *SyncGroup) remove(p *PlaybackStream) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, q := range g.streams {
+		if q == p {
+			g.streams = append(g.streams[:i], g.streams[i+1:]...)
+			return
+		}
+	}
+}
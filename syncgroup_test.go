@@ -0,0 +1,55 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestSyncGroup(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	silence := Float32Reader(func(buf []float32) (int, error) { return len(buf), nil })
+	g := c.NewSyncGroup()
+	p1, err := c.NewPlayback(silence, PlaybackSyncGroup(g))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := c.NewPlayback(silence, PlaybackSyncGroup(g))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p3, err := c.NewPlayback(silence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	if s.syncIDs[p1.StreamIndex()] != s.syncIDs[p2.StreamIndex()] || s.syncIDs[p1.StreamIndex()] == s.syncIDs[p3.StreamIndex()] {
+		t.Errorf("unexpected sync ids %v", s.syncIDs)
+	}
+	s.mu.Unlock()
+
+	if err := p2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !p1.Running() || !p2.Running() || p3.Running() {
+		t.Error("only the streams of the group should be running")
+	}
+	if n := s.received(proto.OpCorkPlaybackStream); n != 1 {
+		t.Errorf("expected a single cork request, got %d", n)
+	}
+
+	if err := g.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if p1.Running() || p2.Running() {
+		t.Error("streams should be paused")
+	}
+
+	p1.Close()
+	if streams := g.Streams(); len(streams) != 1 || streams[0] != p2 {
+		t.Errorf("unexpected streams %v", streams)
+	}
+}
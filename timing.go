@@ -0,0 +1,258 @@
+package pulse
+
+import (
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// The clock used for timing, tests replace it to make StartAt deterministic.
+var (
+	timeNow   = time.Now
+	timeSleep = time.Sleep
+)
+
+// timingInfo is the result of a latency request, similar to libpulse's pa_timing_info.
+type timingInfo struct {
+	valid      bool
+	timestamp  time.Time     // local time at which the info was valid
+	transport  time.Duration // estimated time for a packet to travel between client and server
+	latency    time.Duration // sink latency
+	playing    bool          // whether the server was playing the stream
+	writeIndex int64
+	readIndex  int64
+}
+
+// newTimingInfo computes timing info from a latency reply.
+// local is the time the request was sent, now is the time the reply was received.
+func newTimingInfo(rpl *proto.GetPlaybackLatencyReply, local, now time.Time) timingInfo {
+	info := timingInfo{
+		valid:      true,
+		latency:    rpl.Latency.Duration(),
+		playing:    rpl.Running,
+		writeIndex: rpl.WriteIndex,
+		readIndex:  rpl.ReadIndex,
+	}
+	remote := rpl.ReplyTime.Time()
+	if !remote.Before(local.Truncate(time.Microsecond)) && !remote.After(now) {
+		// The clocks of client and server seem to be synchronized (usually because they run on the same machine).
+		if remote.After(local) {
+			info.transport = remote.Sub(local)
+		}
+		info.timestamp = remote
+	} else {
+		// Estimate the transport latency as half of the round-trip time.
+		info.transport = now.Sub(local) / 2
+		info.timestamp = local.Add(info.transport)
+	}
+	return info
+}
+
+// UpdateTiming queries the server for the stream's current timing information.
+// This is done automatically by Time, Position and Latency unless automatic updates are enabled
+// with PlaybackTimingUpdates.
+func (p *PlaybackStream) UpdateTiming() error {
+	var rpl proto.GetPlaybackLatencyReply
+	local := timeNow()
+	err := p.c.request(&proto.GetPlaybackLatency{StreamIndex: p.index, Time: proto.NewTime(local)}, &rpl)
+	if err != nil {
+		return err
+	}
+	info := newTimingInfo(&rpl, local, timeNow())
+	p.timingLock.Lock()
+	p.timing = info
+	p.timingLock.Unlock()
+	return nil
+}
+
+// Time returns the stream time, i.e. the position in the stream of the sample that is currently being played.
+// The stream time starts at 0 when the stream is created, it increases while the stream is playing
+// and does not decrease.
+func (p *PlaybackStream) Time() (time.Duration, error) {
+	info, err := p.timingInfo()
+	if err != nil {
+		return 0, err
+	}
+	return p.time(info, timeNow()), nil
+}
+
+// Position returns the number of frames that have actually been played.
+// This is Time converted to frames.
+func (p *PlaybackStream) Position() (int64, error) {
+	t, err := p.Time()
+	if err != nil {
+		return 0, err
+	}
+	return int64(t) * int64(p.rate()) / int64(time.Second), nil
+}
+
+// Latency returns the time until a sample that is written now will be played,
+// including the audio buffered on the server and the latency of the sink.
+func (p *PlaybackStream) Latency() (time.Duration, error) {
+	info, err := p.timingInfo()
+	if err != nil {
+		return 0, err
+	}
+	written := p.bytesToDuration(info.writeIndex)
+	t := p.time(info, timeNow())
+	if written < t {
+		return 0, nil
+	}
+	return written - t, nil
+}
+
+func (p *PlaybackStream) timingInfo() (timingInfo, error) {
+	if !p.timingAuto {
+		if err := p.UpdateTiming(); err != nil {
+			return timingInfo{}, err
+		}
+	}
+	p.timingLock.Lock()
+	info := p.timing
+	p.timingLock.Unlock()
+	if !info.valid {
+		if err := p.UpdateTiming(); err != nil {
+			return timingInfo{}, err
+		}
+		p.timingLock.Lock()
+		info = p.timing
+		p.timingLock.Unlock()
+	}
+	return info, nil
+}
+
+// time computes the stream time from timing info, like pa_stream_get_time.
+func (p *PlaybackStream) time(info timingInfo, now time.Time) time.Duration {
+	t := p.bytesToDuration(info.readIndex)
+	if info.playing && p.state.is(running) {
+		t += info.transport
+		if p.timingAuto {
+			// interpolate
+			t += now.Sub(info.timestamp)
+			if written := p.bytesToDuration(info.writeIndex); t > written+info.latency {
+				t = written + info.latency
+			}
+		}
+		if t > info.latency {
+			t -= info.latency
+		} else {
+			t = 0
+		}
+	}
+
+	// The stream time should never go backwards.
+	p.timingLock.Lock()
+	defer p.timingLock.Unlock()
+	if t < p.lastTime {
+		t = p.lastTime
+	}
+	p.lastTime = t
+	return t
+}
+
+func (p *PlaybackStream) bytesToDuration(n int64) time.Duration {
+	if n < 0 {
+		return 0
+	}
+	frames := n / int64(p.bytesPerSample*int(p.createReply.Channels))
+	rate := int64(p.rate())
+	return time.Duration(frames/rate)*time.Second + time.Duration(frames%rate*int64(time.Second)/rate)
+}
+
+func (p *PlaybackStream) updateTimingLoop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := p.UpdateTiming(); err != nil && p.c.logger != nil && !p.Closed() {
+			p.c.logger.Log(proto.LevelWarn, "pulse: timing update failed", "index", p.index, "error", err)
+		}
+		select {
+		case <-t.C:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// PlaybackTimingUpdates enables automatic timing updates.
+// The stream's timing information will be queried every interval, and Time, Position and Latency
+// will interpolate between updates instead of sending a request on every call.
+// This is useful if the timing is needed frequently, e.g. for synchronizing video to the audio.
+func PlaybackTimingUpdates(interval time.Duration) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.timingAuto = interval > 0
+		p.timingInterval = interval
+	}
+}
+
+// StartAt starts playing audio so that the first sample is heard at time t.
+// It blocks until the stream is started, which is at most one buffer length (see PlaybackLatency) before t.
+// Until t, silence is played; the amount of silence is computed from the latency of the sink
+// and the estimated transport latency.
+// If the stream belongs to a SyncGroup, all streams in the group are started.
+//
+// StartAt returns the estimated error, i.e. the difference between the time the first sample is heard and t.
+// A positive error means that the stream started late, e.g. because t was in the past.
+//
+// For streams created with NewPushPlayback, data that was written before calling StartAt is played before t.
+func (p *PlaybackStream) StartAt(t time.Time) (time.Duration, error) {
+	if p.group != nil {
+		return p.group.StartAt(t)
+	}
+	return startPlaybackAt([]*PlaybackStream{p}, t)
+}
+
+// startPlaybackAt starts all idle streams in ps at time t, see startPlayback.
+func startPlaybackAt(ps []*PlaybackStream, t time.Time) (time.Duration, error) {
+	var p *PlaybackStream
+	for _, q := range ps {
+		if q.state.is(idle) {
+			p = q
+			break
+		}
+	}
+	if p == nil {
+		return 0, nil
+	}
+
+	// The silence has to fit into the buffer.
+	lead := p.bytesToDuration(int64(p.BufferAttr().TargetLength))
+	if d := t.Sub(timeNow()) - lead; d > 0 {
+		timeSleep(d)
+	}
+
+	if err := p.UpdateTiming(); err != nil {
+		return 0, err
+	}
+	p.timingLock.Lock()
+	info := p.timing
+	p.timingLock.Unlock()
+	// Pull streams are flushed when they are started, push streams play the data that was already written.
+	start := info.readIndex
+	if p.r == nil && info.writeIndex > start {
+		start = info.writeIndex
+	}
+	silence := t.Sub(timeNow()) - info.transport - info.latency - p.bytesToDuration(start-info.readIndex)
+	if silence < 0 {
+		silence = 0
+	}
+	if err := startPlayback(ps, silence); err != nil {
+		return 0, err
+	}
+	start += int64(p.durationToBytes(silence))
+
+	// Estimate when the first sample will be heard from the stream's current read index.
+	if err := p.UpdateTiming(); err != nil {
+		return 0, err
+	}
+	p.timingLock.Lock()
+	info = p.timing
+	p.timingLock.Unlock()
+	heard := info.timestamp.Add(info.latency)
+	if start >= info.readIndex {
+		heard = heard.Add(p.bytesToDuration(start - info.readIndex))
+	} else {
+		heard = heard.Add(-p.bytesToDuration(info.readIndex - start))
+	}
+	return heard.Sub(t), nil
+}
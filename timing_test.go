@@ -0,0 +1,208 @@
+package pulse
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// replyLatency makes the server answer latency requests with the given indices.
+func replyLatency(s *testServer, readIndex, writeIndex int64, latency time.Duration) {
+	s.handle = func(c *serverConn, op, tag uint32, args []interface{}) bool {
+		if op != proto.OpGetPlaybackLatency {
+			return false
+		}
+		requestTime := args[1].(proto.Time)
+		c.reply(tag, new(tags).
+			usec(proto.Microseconds(latency/time.Microsecond)).usec(0).boolean(true).
+			time(requestTime).time(requestTime).
+			i64(writeIndex).i64(readIndex).
+			u64r(0).u64r(0))
+		return true
+	}
+}
+
+func TestPlaybackTiming(t *testing.T) {
+	s := newTestServer(t)
+	replyLatency(s, 2*44100, 3*44100, 100*time.Millisecond)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackSampleRate(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Start()
+	tm, err := p.Time()
+	if err != nil || !near(tm, 900*time.Millisecond) {
+		t.Errorf("Time returned %v, %v", tm, err)
+	}
+	if pos, err := p.Position(); err != nil || pos < 44100*899/1000 || pos > 44100*901/1000 {
+		t.Errorf("Position returned %v, %v", pos, err)
+	}
+	if l, err := p.Latency(); err != nil || !near(l, 600*time.Millisecond) {
+		t.Errorf("Latency returned %v, %v", l, err)
+	}
+}
+
+func TestPlaybackTimingInterpolation(t *testing.T) {
+	s := newTestServer(t)
+	replyLatency(s, 2*44100, 4*44100, 100*time.Millisecond)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackSampleRate(44100), PlaybackTimingUpdates(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	t1, err := p.Time()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := s.received(proto.OpGetPlaybackLatency)
+	time.Sleep(20 * time.Millisecond)
+	t2, err := p.Time()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := t2 - t1; d < 20*time.Millisecond || d > 200*time.Millisecond {
+		t.Errorf("expected interpolated time to advance by about 20ms, got %v", d)
+	}
+	if n := s.received(proto.OpGetPlaybackLatency); n != requests {
+		t.Errorf("expected no additional latency requests, got %d", n-requests)
+	}
+}
+
+func near(d, want time.Duration) bool {
+	return d > want-time.Millisecond && d < want+time.Millisecond
+}
+
+// fakeClock replaces the clock used by StartAt until restore is called.
+// Sleeping advances the clock without waiting.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept time.Duration
+}
+
+func useFakeClock() *fakeClock {
+	// Timestamps are sent with microsecond precision, so start at a whole second.
+	c := &fakeClock{now: time.Unix(1e9, 0)}
+	timeNow = c.Now
+	timeSleep = c.Sleep
+	return c
+}
+
+func (c *fakeClock) restore() {
+	timeNow = time.Now
+	timeSleep = time.Sleep
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.slept += d
+}
+
+func TestPlaybackStartAt(t *testing.T) {
+	clock := useFakeClock()
+	defer clock.restore()
+	s := newTestServer(t)
+	replyLatency(s, 0, 0, 50*time.Millisecond)
+	c := s.client()
+	defer c.Close()
+
+	// The server requests 100ms of audio when the stream is started.
+	var read int64
+	p, err := c.NewPlayback(Uint8Reader(func(buf []byte) (int, error) {
+		atomic.AddInt64(&read, int64(len(buf)))
+		return len(buf), nil
+	}), PlaybackSampleRate(8000), PlaybackMono)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream is started 100ms before the requested time, then 50ms of silence are played.
+	at := clock.Now().Add(150 * time.Millisecond)
+	e, err := p.StartAt(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clock.slept != 50*time.Millisecond {
+		t.Errorf("expected to sleep 50ms, slept %v", clock.slept)
+	}
+	if e != 0 {
+		t.Errorf("estimated error %v", e)
+	}
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 800 })
+	if n := atomic.LoadInt64(&read); n != 400 {
+		t.Errorf("expected 50ms of silence, %d bytes were read", n)
+	}
+}
+
+func TestPushPlaybackStartAt(t *testing.T) {
+	clock := useFakeClock()
+	defer clock.restore()
+	s := newTestServer(t)
+	replyLatency(s, 0, 0, 50*time.Millisecond)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackSampleRate(8000), PlaybackMono)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := p.StartAt(clock.Now().Add(80 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clock.slept != 0 || e != 0 {
+		t.Errorf("slept %v, estimated error %v", clock.slept, e)
+	}
+	// 30ms of silence are written.
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) > 0 })
+	if n := s.dataReceived(p.StreamIndex()); n != 480 {
+		t.Errorf("expected 30ms of silence, got %d bytes", n)
+	}
+	if w := p.Writable(); w != 1120 {
+		t.Errorf("Writable returned %d", w)
+	}
+}
+
+func TestPushPlaybackStartAtFull(t *testing.T) {
+	clock := useFakeClock()
+	defer clock.restore()
+	s := newTestServer(t)
+	// The server has not yet received the data that was written.
+	replyLatency(s, 0, 0, 0)
+	c := s.client()
+	defer c.Close()
+
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackSampleRate(8000), PlaybackMono)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.StartAt(clock.Now().Add(80 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	// Only as much silence as the server requested is written.
+	waitFor(t, func() bool { return s.dataReceived(p.StreamIndex()) == 1600 })
+	if w := p.Writable(); w != 0 {
+		t.Errorf("Writable returned %d", w)
+	}
+}
@@ -0,0 +1,40 @@
+package pulse
+
+import "github.com/jfreymuth/pulse/proto"
+
+// sendVolume sends a volume change to the application.
+func sendVolume(ch chan proto.ChannelVolumes, volume proto.ChannelVolumes) {
+	// Drop last volume change, if not received by the application.
+	// This way, if ch is a buffered channel, some updates
+	// might get lost when the receiver is slow but it will always
+	// receive the latest volume eventually.
+	select {
+	case <-ch:
+		// Dropped, so there was something in the buffered channel.
+	default:
+		// Not dropped, so if the channel is buffered, it should have
+		// room now.
+	}
+
+	// Send the new volume.
+	select {
+	case ch <- volume:
+		// Succeeded in sending!
+	default:
+		// Somehow couldn't send the new volume value. Perhaps the
+		// channel is unbuffered, and the receiving goroutine is doing
+		// other things? There's not much we can do about it here.
+	}
+}
+
+// sendMute sends a mute change to the application, like sendVolume.
+func sendMute(ch chan bool, muted bool) {
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- muted:
+	default:
+	}
+}
@@ -0,0 +1,120 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackMuteChanges(t *testing.T) {
+	s := newTestServer(t)
+	var muted bool
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpSetSinkInputMute:
+			muted = a[1].(bool)
+			c.reply(tag, new(tags))
+			c.send(proto.OpSubscribeEvent, new(tags).u32(uint32(proto.EventSinkSinkInput|proto.EventChange)).u32(a[0].(uint32)))
+			return true
+		case proto.OpGetSinkInputInfo:
+			c.reply(tag, new(tags).
+				u32(a[0].(uint32)).str("test").u32(0).u32(0).u32(0).
+				spec(proto.SampleSpec{Format: proto.FormatInt16LE, Channels: 1, Rate: 44100}).
+				channelMap(proto.ChannelMap{proto.ChannelMono}).volumes(proto.ChannelVolumes{proto.VolumeNorm}).
+				usec(0).usec(0).str("").str("").
+				boolean(muted).propList(proto.PropList{}).boolean(false).boolean(true).boolean(true).
+				format(proto.EncodingPCM))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	changes := make(chan bool, 1)
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackMuted(false), PlaybackMuteChanges(changes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMute(true); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-changes; !m {
+		t.Error("expected mute change")
+	}
+	if m, err := p.Mute(); !m || err != nil {
+		t.Errorf("Mute returned %v, %v", m, err)
+	}
+	p.Close()
+	if _, ok := <-changes; ok {
+		t.Error("channel was not closed")
+	}
+}
+
+func TestRecordVolume(t *testing.T) {
+	s := newTestServer(t)
+	var args []interface{}
+	volume := proto.ChannelVolumes{proto.VolumeNorm, proto.VolumeNorm}
+	var muted bool
+	s.handle = func(c *serverConn, op, tag uint32, a []interface{}) bool {
+		switch op {
+		case proto.OpCreateRecordStream:
+			args = a
+		case proto.OpSetSourceOutputVolume, proto.OpSetSourceOutputMute:
+			if op == proto.OpSetSourceOutputVolume {
+				volume = a[1].(proto.ChannelVolumes)
+			} else {
+				muted = a[1].(bool)
+			}
+			c.reply(tag, new(tags))
+			c.send(proto.OpSubscribeEvent, new(tags).u32(uint32(proto.EventSinkSourceOutput|proto.EventChange)).u32(a[0].(uint32)))
+			return true
+		case proto.OpGetSourceOutputInfo:
+			c.reply(tag, new(tags).
+				u32(a[0].(uint32)).str("test").u32(0).u32(0).u32(0).
+				spec(proto.SampleSpec{Format: proto.FormatInt16LE, Channels: 2, Rate: 44100}).
+				channelMap(proto.ChannelMap{proto.ChannelLeft, proto.ChannelRight}).
+				usec(0).usec(0).str("").str("").
+				propList(proto.PropList{}).boolean(false).
+				volumes(volume).boolean(muted).boolean(true).boolean(true).
+				format(proto.EncodingPCM))
+			return true
+		}
+		return false
+	}
+	c := s.client()
+	defer c.Close()
+
+	volumes := make(chan proto.ChannelVolumes, 1)
+	mutes := make(chan bool, 1)
+	r, err := c.NewPullRecord(proto.FormatInt16LE, RecordStereo,
+		RecordVolume(proto.ChannelVolumes{proto.VolumeNorm, proto.VolumeNorm}), RecordMuted(false),
+		RecordVolumeChanges(volumes), RecordMuteChanges(mutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// volume, muted, volume set, muted set
+	if args[23] != false || args[24] != true || args[25] != true {
+		t.Errorf("unexpected request %v", args)
+	}
+
+	if err := r.SetVolume(proto.ChannelVolumes{proto.VolumeNorm / 2, proto.VolumeNorm}); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-volumes; v[0] != proto.VolumeNorm/2 || v[1] != proto.VolumeNorm {
+		t.Errorf("unexpected volume %v", v)
+	}
+	if v, err := r.Volume(); err != nil || v[0] != proto.VolumeNorm/2 {
+		t.Errorf("Volume returned %v, %v", v, err)
+	}
+
+	if err := r.SetMute(true); err != nil {
+		t.Fatal(err)
+	}
+	if m := <-mutes; !m {
+		t.Error("expected mute change")
+	}
+	if m, err := r.Mute(); !m || err != nil {
+		t.Errorf("Mute returned %v, %v", m, err)
+	}
+}
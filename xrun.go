@@ -0,0 +1,143 @@
+package pulse
+
+import (
+	"sync"
+	"time"
+)
+
+// An Xrun describes an underflow or overflow of a stream.
+type Xrun struct {
+	// Time is the local time at which the server's notification was received.
+	Time time.Time
+	// Offset is the position of an underflow in frames, comparable to (*PlaybackStream).Position.
+	// It is -1 for overflows, and for underflows if the server does not report the position.
+	Offset int64
+}
+
+// xrunCounter counts the xruns of a stream since it was started.
+type xrunCounter struct {
+	mu     sync.Mutex
+	count  int
+	last   Xrun
+	recent bool // whether an xrun happened since the last call to resume
+	events chan<- Xrun
+}
+
+func (x *xrunCounter) add(xrun Xrun) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.count++
+	x.last = xrun
+	x.recent = true
+	if x.events != nil {
+		select {
+		case x.events <- xrun:
+		default:
+		}
+	}
+}
+
+func (x *xrunCounter) get() (int, Xrun) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.count, x.last
+}
+
+func (x *xrunCounter) happened() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.recent
+}
+
+// reset is called when the stream is started.
+func (x *xrunCounter) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.count = 0
+	x.last = Xrun{}
+	x.recent = false
+}
+
+// resume is called when the stream is resumed.
+func (x *xrunCounter) resume() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.recent = false
+}
+
+// close closes the events channel.
+func (x *xrunCounter) close() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.events != nil {
+		close(x.events)
+		x.events = nil
+	}
+}
+
+// underflowed is called when the server reports an underflow at offset bytes.
+func (p *PlaybackStream) underflowed(offset int64) {
+	if p.c.c.Version() < 23 {
+		offset = -1
+	} else {
+		offset /= int64(p.bytesPerSample * p.Channels())
+	}
+	p.underflows.add(Xrun{Time: time.Now(), Offset: offset})
+}
+
+// Underflows returns the number of underflows since the last call to Start, and the most recent underflow.
+func (p *PlaybackStream) Underflows() (int, Xrun) { return p.underflows.get() }
+
+// overflowed is called when the server reports an overflow.
+func (p *PlaybackStream) overflowed() {
+	p.overflows.add(Xrun{Time: time.Now(), Offset: -1})
+}
+
+// Overflow returns true if any overflows happened since the last call to Start or Resume.
+// Overflows mean that more data was written than the server requested, the server discarded the excess data.
+// See also Overflows.
+func (p *PlaybackStream) Overflow() bool { return p.overflows.happened() }
+
+// Overflows returns the number of overflows since the last call to Start, and the most recent overflow.
+func (p *PlaybackStream) Overflows() (int, Xrun) { return p.overflows.get() }
+
+// bufferOverflow is called when recorded data is discarded because the read buffer is full.
+func (r *RecordStream) bufferOverflow() {
+	r.overflows.add(Xrun{Time: time.Now(), Offset: -1})
+	if r.observer != nil {
+		r.observer.Overflow(r.index)
+	}
+}
+
+// Overflow returns true if any overflows happened since the last call to Start.
+// Overflows mean that recorded audio was discarded because Read was not called often enough,
+// see RecordReadBufferSize and RecordOverflowPolicy.
+// Only streams created with NewPullRecord can overflow.
+func (r *RecordStream) Overflow() bool { return r.overflows.happened() }
+
+// Overflows returns the number of overflows since the last call to Start, and the most recent overflow.
+func (r *RecordStream) Overflows() (int, Xrun) { return r.overflows.get() }
+
+// PlaybackUnderflows sets a channel that receives every underflow of the stream.
+// Underflows are dropped if the channel is full. The channel is closed when the stream is closed.
+func PlaybackUnderflows(underflows chan<- Xrun) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.underflows.events = underflows
+	}
+}
+
+// PlaybackOverflows sets a channel that receives every overflow of the stream.
+// Overflows are dropped if the channel is full. The channel is closed when the stream is closed.
+func PlaybackOverflows(overflows chan<- Xrun) PlaybackOption {
+	return func(p *PlaybackStream) {
+		p.overflows.events = overflows
+	}
+}
+
+// RecordOverflows sets a channel that receives every overflow of the stream.
+// Overflows are dropped if the channel is full. The channel is closed when the stream is closed.
+func RecordOverflows(overflows chan<- Xrun) RecordOption {
+	return func(r *RecordStream) {
+		r.overflows.events = overflows
+	}
+}
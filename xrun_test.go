@@ -0,0 +1,134 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestPlaybackUnderflows(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	underflows := make(chan Xrun, 4)
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackStereo, PlaybackUnderflows(underflows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.send(proto.OpUnderflow, new(tags).u32(p.StreamIndex()).i64(4000))
+	if u := <-underflows; u.Offset != 1000 || u.Time.IsZero() {
+		t.Errorf("unexpected underflow %+v", u)
+	}
+	s.send(proto.OpUnderflow, new(tags).u32(p.StreamIndex()).i64(8000))
+	<-underflows
+	if n, last := p.Underflows(); n != 2 || last.Offset != 2000 || !p.Underflow() {
+		t.Errorf("Underflows returned %d, %+v", n, last)
+	}
+
+	// Resume clears Underflow, but not the counter.
+	p.Pause()
+	p.Resume()
+	if n, _ := p.Underflows(); n != 2 || p.Underflow() {
+		t.Errorf("after resuming: %d underflows, Underflow returned %v", n, p.Underflow())
+	}
+
+	p.Stop()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if n, last := p.Underflows(); n != 0 || last != (Xrun{}) {
+		t.Errorf("Start did not reset the underflows: %d, %+v", n, last)
+	}
+
+	p.Close()
+	if _, ok := <-underflows; ok {
+		t.Error("channel was not closed")
+	}
+}
+
+func TestPlaybackOverflows(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	overflows := make(chan Xrun, 4)
+	p, err := c.NewPushPlayback(proto.FormatInt16LE, PlaybackOverflows(overflows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewPullRecord(proto.FormatInt16LE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overflows are reported for playback streams, the index of a record stream is ignored.
+	s.send(proto.OpOverflow, new(tags).u32(r.StreamIndex()))
+	s.send(proto.OpOverflow, new(tags).u32(p.StreamIndex()))
+	if o := <-overflows; o.Offset != -1 || o.Time.IsZero() {
+		t.Errorf("unexpected overflow %+v", o)
+	}
+	if n, _ := p.Overflows(); n != 1 || !p.Overflow() {
+		t.Errorf("Overflows returned %d, Overflow returned %v", n, p.Overflow())
+	}
+	if r.Overflow() {
+		t.Error("overflow reported for the record stream")
+	}
+
+	// Resume clears Overflow, but not the counter.
+	p.Pause()
+	p.Resume()
+	if n, _ := p.Overflows(); n != 1 || p.Overflow() {
+		t.Errorf("after resuming: %d overflows, Overflow returned %v", n, p.Overflow())
+	}
+	p.Close()
+	if _, ok := <-overflows; ok {
+		t.Error("channel was not closed")
+	}
+}
+
+func TestRecordOverflows(t *testing.T) {
+	s := newTestServer(t)
+	c := s.client()
+	defer c.Close()
+
+	overflows := make(chan Xrun, 4)
+	r, err := c.NewPullRecord(proto.FormatInt16LE, RecordReadBufferSize(8), RecordOverflows(overflows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Overflow() {
+		t.Error("overflow before Start")
+	}
+
+	// The data doesn't fit into the read buffer.
+	s.conns[0].sendData(r.StreamIndex(), make([]byte, 10))
+	if o := <-overflows; o.Offset != -1 || o.Time.IsZero() {
+		t.Errorf("unexpected overflow %+v", o)
+	}
+	if n, _ := r.Overflows(); n != 1 || !r.Overflow() {
+		t.Errorf("Overflows returned %d, Overflow returned %v", n, r.Overflow())
+	}
+
+	r.Stop()
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.Overflows(); n != 0 || r.Overflow() {
+		t.Errorf("Start did not reset the overflows")
+	}
+	r.Close()
+	if _, ok := <-overflows; ok {
+		t.Error("channel was not closed")
+	}
+}